@@ -0,0 +1,60 @@
+// リスト全体を 1 行に保存していた TODO テーブルのデータを、タスクごとの行に分けた新しいテーブルに移行する
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/yotu/wakaba/internal/repository"
+)
+
+func main() {
+	// Load .env file if it exists
+	_ = godotenv.Load()
+
+	from := flag.String("from", "wakaba-production-todo", "Legacy table to read lists from")
+	to := flag.String("to", os.Getenv("DYNAMODB_TABLE_NAME"), "Table to write lists to (defaults to DYNAMODB_TABLE_NAME)")
+	dryRun := flag.Bool("dry-run", false, "Only print what would be migrated")
+	flag.Parse()
+
+	if *to == "" {
+		*to = "wakaba-production-todo-items"
+	}
+	if *from == *to {
+		log.Fatal("-from and -to must be different tables")
+	}
+
+	ctx := context.Background()
+	repo, err := repository.NewTodoRepositoryForTable(ctx, *to)
+	if err != nil {
+		log.Fatalf("Repository init failed: %v", err)
+	}
+
+	log.Printf("Migrating todo lists from %s to %s...", *from, *to)
+	var migrated, skipped int
+	err = repo.ScanLegacyTodoLists(ctx, *from, func(list *repository.TodoList) error {
+		if *dryRun {
+			log.Printf("Would migrate channel %s (%d items)", list.ChannelID, len(list.Items))
+			return nil
+		}
+		ok, err := repo.ImportTodoList(ctx, list)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Printf("Skipped channel %s: a list already exists in %s", list.ChannelID, *to)
+			skipped++
+			return nil
+		}
+		log.Printf("Migrated channel %s (%d items)", list.ChannelID, len(list.Items))
+		migrated++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+	log.Printf("Done! migrated: %d, skipped: %d", migrated, skipped)
+}
@@ -7,8 +7,24 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
+	"github.com/yotu/wakaba/internal/todo"
 )
 
+// /summarize top と /list move position の最小値 (discordgo では MinValue だけがポインタ)
+var positiveMinValue = 1.0
+
+// /digest で選べるチャンネルの種類
+var digestChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews}
+
+// /list の add, edit, remove, move で操作するリストを選ぶオプション
+var todoListOption = &discordgo.ApplicationCommandOption{
+	Type:         discordgo.ApplicationCommandOptionString,
+	Name:         "list",
+	Description:  "操作するリストの名前 (省略時はチャンネルの既定のリスト)",
+	MaxLength:    todo.MaxListNameLength,
+	Autocomplete: true,
+}
+
 func main() {
 	// Load .env file if it exists
 	_ = godotenv.Load()
@@ -39,13 +55,25 @@ func main() {
 	commands := []*discordgo.ApplicationCommand{
 		{
 			Name:        "summarize",
-			Description: "指定された日のリンクをまとめます",
+			Description: "指定された日（期間）のリンクをまとめます",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
 					Name:        "date",
-					Description: "日付 (MMDD または YYYYMMDD)",
-					Required:    true,
+					Description: "日付 (1017, 10/17, today, 昨日, -3d, 先週, 1014-1017 など)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "from",
+					Description: "期間の開始日 (1014, 10/14, -3d, 月曜 など)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "to",
+					Description: "期間の終了日 (省略時は今日)",
+					Required:    false,
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionBoolean,
@@ -53,6 +81,203 @@ func main() {
 					Description: "urlにタイトルをつけるかどうか",
 					Required:    false,
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "format",
+					Description: "ファイルとして添付する形式 (省略時は添付なし)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "text (添付なし)", Value: "text"},
+						{Name: "markdown", Value: "markdown"},
+						{Name: "csv", Value: "csv"},
+						{Name: "json", Value: "json"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "dedupe",
+					Description: "同じリンクを1つにまとめ、共有回数と共有者を表示します",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "sources",
+					Description: "リンクを探す場所 (content,embeds,attachments,forwards,replies をカンマ区切り。省略時は replies 以外)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "include_threads",
+					Description: "スレッドやフォーラムの投稿も対象にし、スレッドごとにまとめます",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "scope",
+					Description: "対象にするチャンネルの範囲 (省略時はこのチャンネル)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "このチャンネル", Value: "channel"},
+						{Name: "同じカテゴリのチャンネル", Value: "category"},
+						{Name: "サーバー全体", Value: "guild"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "このユーザーが投稿したリンクだけを対象にします",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "domain",
+					Description: "対象にするドメイン (カンマ区切り。例: github.com)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "exclude_domain",
+					Description: "対象にしないドメイン (カンマ区切り。例: tenor.com)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "keyword",
+					Description: "メッセージかリンク先のタイトルにこの文字列を含むリンクだけを対象にします",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "hide_authors",
+					Description: "まとめに投稿者を表示しません",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "group_by",
+					Description: "見出しごとにまとめる方法 (省略時はまとめない)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "まとめない", Value: "none"},
+						{Name: "投稿者", Value: "author"},
+						{Name: "ドメイン", Value: "domain"},
+						{Name: "時間帯", Value: "hour"},
+						{Name: "種類 (動画・画像・コードなど)", Value: "content_type"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "sort",
+					Description: "リンクの並び順 (省略時は投稿順)",
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "投稿順", Value: "posted"},
+						{Name: "ドメイン", Value: "domain"},
+						{Name: "リアクションの多い順", Value: "reactions"},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "top",
+					Description: "リアクション・返信・共有の多いリンクを上位 N 件だけ表示します",
+					Required:    false,
+					MinValue:    &positiveMinValue,
+					MaxValue:    50,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "score",
+					Description: "top の順位づけの重み (省略時は reactions:1,replies:2,shares:1)",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "config",
+			Description: "Bot の設定を変更します",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "timezone",
+					Description: "日付の解釈に使うタイムゾーンを設定します（省略時は現在の設定を表示）",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "zone",
+							Description: "IANA タイムゾーン名 (例: Asia/Tokyo, America/New_York)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "scope",
+							Description: "設定の対象 (省略時はサーバー)",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "サーバー", Value: "guild"},
+								{Name: "自分のみ", Value: "user"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "digest",
+			Description: "毎日決まった時刻に前日のリンクのまとめを投稿します",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "subscribe",
+					Description: "定期投稿を設定します (サーバー管理権限が必要)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "time",
+							Description: "投稿する時刻 (例: 09:00。サーバーのタイムゾーン)",
+							Required:    true,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "まとめるチャンネル (省略時はこのチャンネル)",
+							Required:     false,
+							ChannelTypes: digestChannelTypes,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "target",
+							Description:  "まとめを投稿するチャンネル (省略時はこのチャンネル)",
+							Required:     false,
+							ChannelTypes: digestChannelTypes,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "unsubscribe",
+					Description: "定期投稿を解除します (サーバー管理権限が必要)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "まとめるチャンネル (省略時はこのチャンネル)",
+							Required:     false,
+							ChannelTypes: digestChannelTypes,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "target",
+							Description:  "まとめを投稿するチャンネル (省略時はこのチャンネル)",
+							Required:     false,
+							ChannelTypes: digestChannelTypes,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "このサーバーの定期投稿の設定を表示します",
+				},
 			},
 		},
 		{
@@ -63,6 +288,14 @@ func main() {
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "create",
 					Description: "TODOリストを作成します",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "リストの名前 (省略時はチャンネルの既定のリスト)",
+							MaxLength:   todo.MaxListNameLength,
+						},
+					},
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -75,6 +308,65 @@ func main() {
 							Description: "追加するタスクの内容",
 							Required:    true,
 						},
+						todoListOption,
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "edit",
+					Description: "TODOの内容を変更します",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionInteger,
+							Name:         "item",
+							Description:  "変更するタスクの番号",
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "content",
+							Description: "新しいタスクの内容",
+							Required:    true,
+						},
+						todoListOption,
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "TODOを削除します",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionInteger,
+							Name:         "item",
+							Description:  "削除するタスクの番号",
+							Required:     true,
+							Autocomplete: true,
+						},
+						todoListOption,
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "move",
+					Description: "TODOの順番を変更します",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionInteger,
+							Name:         "item",
+							Description:  "移動するタスクの番号",
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "position",
+							Description: "移動先の番号 (1 で先頭)",
+							Required:    true,
+							MinValue:    &positiveMinValue,
+						},
+						todoListOption,
 					},
 				},
 			},
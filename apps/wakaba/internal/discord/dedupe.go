@@ -0,0 +1,21 @@
+package discord
+
+import "github.com/yotu/wakaba/internal/util"
+
+// 正規化すると同じ URL になるリンクを、最初に投稿されたものにまとめる
+// 後から投稿されたものは Duplicates に入る
+func DedupeLinks(links []CapturedLink) []CapturedLink {
+	var result []CapturedLink
+	index := map[string]int{}
+
+	for _, link := range links {
+		key := util.CanonicalizeURL(link.URL)
+		if i, ok := index[key]; ok {
+			result[i].Duplicates = append(result[i].Duplicates, link)
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, link)
+	}
+	return result
+}
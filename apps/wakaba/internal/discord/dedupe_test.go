@@ -0,0 +1,38 @@
+package discord
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeLinks(t *testing.T) {
+	links := []CapturedLink{
+		{URL: "https://youtu.be/abc?si=1", MessageID: "1", AuthorID: "10", AuthorName: "alice"},
+		{URL: "https://example.com/a", MessageID: "2", AuthorID: "11", AuthorName: "bob"},
+		{URL: "https://www.youtube.com/watch?v=abc&feature=share", MessageID: "3", AuthorID: "11", AuthorName: "bob"},
+		{URL: "https://example.com/a/?utm_source=x", MessageID: "4", AuthorID: "10", AuthorName: "alice"},
+		{URL: "https://m.youtube.com/watch?v=abc", MessageID: "5", AuthorID: "10", AuthorName: "alice"},
+		{URL: "https://example.com/b", MessageID: "6", AuthorID: "12", AuthorName: "carol"},
+	}
+
+	got := DedupeLinks(links)
+
+	if len(got) != 3 {
+		t.Fatalf("len(DedupeLinks()) = %d, want 3", len(got))
+	}
+
+	wantURLs := []string{"https://youtu.be/abc?si=1", "https://example.com/a", "https://example.com/b"}
+	wantCounts := []int{3, 2, 1}
+	wantSharers := [][]string{{"alice", "bob"}, {"bob", "alice"}, {"carol"}}
+	for i, link := range got {
+		if link.URL != wantURLs[i] {
+			t.Errorf("got[%d].URL = %q, want %q (first posted URL is kept)", i, link.URL, wantURLs[i])
+		}
+		if link.ShareCount() != wantCounts[i] {
+			t.Errorf("got[%d].ShareCount() = %d, want %d", i, link.ShareCount(), wantCounts[i])
+		}
+		if !reflect.DeepEqual(link.Sharers(), wantSharers[i]) {
+			t.Errorf("got[%d].Sharers() = %v, want %v", i, link.Sharers(), wantSharers[i])
+		}
+	}
+}
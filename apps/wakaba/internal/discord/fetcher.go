@@ -1,78 +1,333 @@
 package discord
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/yotu/wakaba/internal/util"
 )
 
+// Discord Snowflake ID の基準時刻 (2015-01-01T00:00:00Z) のミリ秒
+const discordEpoch = 1420070400000
+
+// ChannelMessages で一度に取得できる最大件数
+const messagesPerRequest = 100
+
+// メッセージから抽出したリンクを示す構造体
+type CapturedLink struct {
+	URL        string
+	Label      string     // マスクリンク [label](url) の表示テキストや添付ファイル名
+	Origin     LinkSource // リンクを抽出した場所
+	PostedAt   time.Time
+	MessageID  string
+	ChannelID  string // スレッドの場合はスレッドの ID
+	ThreadName string // スレッドの名前。親チャンネルのメッセージの場合は空
+	// scope が category・guild の場合のチャンネル名 (スレッドの場合は親チャンネルの名前)
+	ChannelName string
+	AuthorID    string
+	AuthorName  string
+	// メッセージについたリアクションの合計数と、期間内にメッセージへ返信された数
+	ReactionCount int
+	ReplyCount    int
+
+	// DedupeLinks で同じリンクとしてまとめられた、後から投稿されたもの
+	Duplicates []CapturedLink
+}
+
+// このリンクが共有された回数を返す
+func (l CapturedLink) ShareCount() int {
+	return 1 + len(l.Duplicates)
+}
+
+// まとめられたものを含めた、リアクションの合計数を返す
+func (l CapturedLink) TotalReactions() int {
+	total := l.ReactionCount
+	for _, d := range l.Duplicates {
+		total += d.ReactionCount
+	}
+	return total
+}
+
+// まとめられたものを含めた、返信の合計数を返す
+func (l CapturedLink) TotalReplies() int {
+	total := l.ReplyCount
+	for _, d := range l.Duplicates {
+		total += d.ReplyCount
+	}
+	return total
+}
+
+// このリンクを共有したユーザー名を、最初に共有した順に重複なく返す
+func (l CapturedLink) Sharers() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, link := range append([]CapturedLink{l}, l.Duplicates...) {
+		key := link.AuthorID
+		if key == "" {
+			key = link.AuthorName
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, link.AuthorName)
+	}
+	return names
+}
+
+// リンクが投稿されたメッセージへのジャンプリンクを返す
+// DM の場合 guildID は空文字列を渡す
+func (l CapturedLink) JumpURL(guildID string) string {
+	if guildID == "" {
+		guildID = "@me"
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, l.ChannelID, l.MessageID)
+}
+
 // 該当する日付のメッセージを取得する結果を示す構造体
 type FetchResult struct {
-	CapturedLinks []string
-	MessageCount  int
+	CapturedLinks []CapturedLink
+	MessageCount  int // 検索したメッセージの数
+
+	// 検索したメッセージに含まれていたリンクの数と、条件に一致したリンクを含むメッセージの数
+	ScannedLinkCount    int
+	MatchedMessageCount int
+
+	// include_threads の場合に対象にしたスレッドの数と、上限を超えて対象外にしたものがあるか
+	ThreadCount      int
+	ThreadsTruncated bool
+
+	// scope が category・guild の場合に対象にしたチャンネルの数と、権限がないため対象外にしたチャンネルの名前
+	ChannelCount      int
+	ChannelsTruncated bool
+	SkippedChannels   []string
+}
+
+// 指定日時に作成されたメッセージが取りうる最小の Snowflake ID を返す
+func snowflakeFromTime(t time.Time) int64 {
+	ms := t.UnixMilli() - discordEpoch
+	if ms < 0 {
+		return 0
+	}
+	return ms << 22
+}
+
+// FetchLinks の抽出方法の指定
+type FetchOptions struct {
+	// リンクを抽出する場所。空の場合は DefaultLinkSources
+	Sources []LinkSource
+	// チャンネルのスレッド (フォーラムチャンネルの場合は投稿) も対象にする
+	IncludeThreads bool
+	// 抽出するリンクの条件。nil の場合はすべてのリンク
+	Filter *LinkFilter
 }
 
 // 該当する日付のメッセージを取得する
-func FetchLinks(s *discordgo.Session, channelID string, start, end time.Time, botID string) (*FetchResult, error) {
-	var messages []*discordgo.Message
-	var lastID string
+// end から start に向かって before カーソルで遡るので、期間外のメッセージはほとんど取得しない
+// opts が nil の場合はデフォルトの設定で抽出する
+// スレッドも対象にする場合、リンクは親チャンネル、スレッドの作成順にまとめて返す
+func FetchLinks(s *discordgo.Session, channelID string, start, end time.Time, botID string, opts *FetchOptions) (*FetchResult, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+	sources := DefaultLinkSources
+	if len(opts.Sources) > 0 {
+		sources = opts.Sources
+	}
 
-	for {
-		// 一度に最大 100 件のメッセージを取得
-		batch, err := s.ChannelMessages(channelID, 100, lastID, "", "")
+	// start 以降に作成されたメッセージの ID は startID 以上になる
+	startID := snowflakeFromTime(start)
+	// end の直後のミリ秒以降に作成されたメッセージの ID は endID 以上になる
+	endID := snowflakeFromTime(end) + (1 << 22)
+
+	targets := []*discordgo.Channel{{ID: channelID}}
+	result := &FetchResult{}
+	if opts.IncludeThreads {
+		parent, err := s.Channel(channelID)
 		if err != nil {
 			return nil, err
 		}
+		threads, truncated, err := listThreads(s, parent, startID, endID)
+		if err != nil {
+			return nil, err
+		}
+		// フォーラムチャンネル自体にはメッセージがない
+		if isForum(parent) {
+			targets = nil
+		}
+		targets = append(targets, threads...)
+		result.ThreadCount = len(threads)
+		result.ThreadsTruncated = truncated
+	}
 
-		if len(batch) == 0 {
-			break
+	filter := opts.Filter
+	// メッセージにキーワードがなく、リンク先のタイトルで判定するリンクの位置
+	var titleChecks []int
+
+	for _, ch := range targets {
+		messages, err := fetchChannelMessages(s, ch.ID, startID, endID, botID)
+		if err != nil {
+			return nil, err
 		}
+		result.MessageCount += len(messages)
+		replies := countReplies(messages)
 
-		lastID = batch[len(batch)-1].ID
+		for _, m := range messages {
+			links := extractMessageLinks(m, sources, startID)
+			result.ScannedLinkCount += len(links)
+			if !filter.matchAuthor(m) {
+				continue
+			}
+			textMatched := filter.matchKeyword(messageText(m))
 
-		// 取得したメッセージを処理
-		for _, m := range batch {
-			// discord Snowflake ID からメッセージの作成時間を逆算
-			ts, err := discordgo.SnowflakeTimestamp(m.ID)
-			if err != nil {
-				ts = m.Timestamp
+			for _, link := range links {
+				if !filter.matchDomain(link.URL) {
+					continue
+				}
+				if !textMatched && !filter.matchKeyword(link.Label) {
+					if filter.Titles == nil {
+						continue
+					}
+					titleChecks = append(titleChecks, len(result.CapturedLinks))
+				}
+				link.ChannelID = ch.ID
+				link.ThreadName = ch.Name
+				fillMessageInfo(&link, m)
+				link.ReplyCount = replies[m.ID]
+				result.CapturedLinks = append(result.CapturedLinks, link)
 			}
+		}
+	}
+
+	if len(titleChecks) > 0 {
+		result.CapturedLinks = filterByTitle(result.CapturedLinks, titleChecks, filter)
+	}
+	result.MatchedMessageCount = countMessages(result.CapturedLinks)
+
+	return result, nil
+}
+
+// indexes の位置のリンクのうち、リンク先のタイトルにキーワードを含まないものを取り除く
+func filterByTitle(links []CapturedLink, indexes []int, filter *LinkFilter) []CapturedLink {
+	candidates := make([]CapturedLink, len(indexes))
+	for i, idx := range indexes {
+		candidates[i] = links[idx]
+	}
+	titles := filter.Titles(candidates)
+
+	drop := map[int]bool{}
+	for i, idx := range indexes {
+		if i >= len(titles) || !filter.matchKeyword(titles[i]) {
+			drop[idx] = true
+		}
+	}
+
+	kept := links[:0]
+	for i, link := range links {
+		if !drop[i] {
+			kept = append(kept, link)
+		}
+	}
+	return kept
+}
+
+// リンクが含まれるメッセージの数を返す
+func countMessages(links []CapturedLink) int {
+	seen := map[string]bool{}
+	for _, l := range links {
+		seen[l.ChannelID+"/"+l.MessageID] = true
+	}
+	return len(seen)
+}
+
+// チャンネルの startID 以上 endID 未満のメッセージを古い順に取得する
+// botID が投稿したメッセージは除く
+func fetchChannelMessages(s *discordgo.Session, channelID string, startID, endID int64, botID string) ([]*discordgo.Message, error) {
+	var messages []*discordgo.Message
+
+	// end の直後のミリ秒を before に指定し、end 以前のメッセージから取得を始める
+	beforeID := strconv.FormatInt(endID, 10)
 
-			// 終了日時よりも新しい場合は、スキップ
-			if ts.After(end) {
+	for {
+		// 一度に最大 100 件のメッセージを取得
+		batch, err := s.ChannelMessages(channelID, messagesPerRequest, beforeID, "", "")
+		if err != nil {
+			return nil, err
+		}
+
+		reachedStart := false
+		for _, m := range batch {
+			id, err := strconv.ParseInt(m.ID, 10, 64)
+			if err != nil {
 				continue
 			}
 
 			// 開始日時よりも古い場合は、取得を終了
-			if ts.Before(start) {
-				goto DONE
+			if id < startID {
+				reachedStart = true
+				break
 			}
 
 			// ボットのメッセージは無視
-			if m.Author.ID == botID {
+			if m.Author != nil && m.Author.ID == botID {
 				continue
 			}
 
 			messages = append(messages, m)
 		}
+
+		if reachedStart || len(batch) < messagesPerRequest {
+			break
+		}
+		beforeID = batch[len(batch)-1].ID
 	}
 
-// すべて取得し終わったら、ソートしてリンクを抽出
-DONE:
+	// すべて取得し終わったら、古い順にソートする
 	sort.Slice(messages, func(i, j int) bool {
-		return messages[i].ID < messages[j].ID
+		return messageID(messages[i]) < messageID(messages[j])
 	})
+	return messages, nil
+}
 
-	var links []string
+// メッセージ ID ごとに、返信しているメッセージの数を返す
+func countReplies(messages []*discordgo.Message) map[string]int {
+	replies := map[string]int{}
 	for _, m := range messages {
-		extracted := util.ExtractURLs(m.Content)
-		links = append(links, extracted...)
+		if m.Type == discordgo.MessageTypeReply && m.MessageReference != nil && m.MessageReference.MessageID != "" {
+			replies[m.MessageReference.MessageID]++
+		}
+	}
+	return replies
+}
+
+// 投稿日時・投稿者・リアクション数をリンクに設定する
+func fillMessageInfo(link *CapturedLink, m *discordgo.Message) {
+	ts, err := discordgo.SnowflakeTimestamp(m.ID)
+	if err != nil {
+		ts = m.Timestamp
 	}
+	link.PostedAt = ts
+	link.MessageID = m.ID
+	for _, r := range m.Reactions {
+		if r != nil {
+			link.ReactionCount += r.Count
+		}
+	}
+
+	if m.Author != nil {
+		link.AuthorID, link.AuthorName = m.Author.ID, m.Author.Username
+		if m.Member != nil && m.Member.Nick != "" {
+			link.AuthorName = m.Member.Nick
+		} else if m.Author.GlobalName != "" {
+			link.AuthorName = m.Author.GlobalName
+		}
+	}
+}
 
-	return &FetchResult{
-		CapturedLinks: links,
-		MessageCount:  len(messages),
-	}, nil
+// Snowflake ID は桁数が変わりうるため、文字列ではなく数値として比較する
+func messageID(m *discordgo.Message) int64 {
+	id, _ := strconv.ParseInt(m.ID, 10, 64)
+	return id
 }
@@ -0,0 +1,284 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeDiscord はメッセージの before カーソルとスレッドの一覧だけを実装した Discord API のフェイク
+type fakeDiscord struct {
+	messages []*discordgo.Message // 親チャンネルのメッセージ (ID の降順)
+	calls    atomic.Int32
+
+	channel        *discordgo.Channel
+	threads        []*discordgo.Channel            // アクティブなスレッドとアーカイブ済みのスレッド
+	threadMessages map[string][]*discordgo.Message // スレッド・チャンネルごとのメッセージ (ID の降順)
+
+	guild     *discordgo.Guild
+	channels  []*discordgo.Channel         // サーバーのチャンネル一覧
+	member    *discordgo.Member            // ボットのメンバー情報
+	members   map[string]*discordgo.Member // ユーザーごとのメンバー情報 (ない場合は member)
+	forbidden map[string]bool              // 403 を返すチャンネル
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+
+	var body any
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v"+discordgo.APIVersion+"/"), "/")
+	switch {
+	case len(path) == 3 && path[0] == "channels" && path[2] == "messages" && f.forbidden[path[1]]:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "Missing Access", "code": 50001}`))
+		return
+	case len(path) == 3 && path[0] == "channels" && path[2] == "messages":
+		messages := f.messages
+		if m, ok := f.threadMessages[path[1]]; ok {
+			messages = m
+		}
+		body = f.messageBatch(messages, r.URL.Query())
+	case len(path) == 2 && path[0] == "channels":
+		body = f.channel
+	case len(path) == 2 && path[0] == "guilds":
+		body = f.guild
+	case len(path) == 3 && path[0] == "guilds" && path[2] == "channels":
+		body = f.channels
+	case len(path) == 4 && path[0] == "guilds" && path[2] == "members":
+		body = f.member
+		if m, ok := f.members[path[3]]; ok {
+			body = m
+		}
+	case len(path) == 4 && path[0] == "guilds" && path[2] == "threads" && path[3] == "active":
+		list := &discordgo.ThreadsList{Threads: []*discordgo.Channel{}}
+		for _, th := range f.threads {
+			if !th.ThreadMetadata.Archived {
+				list.Threads = append(list.Threads, th)
+			}
+		}
+		body = list
+	case len(path) == 5 && path[0] == "channels" && path[2] == "threads" && path[3] == "archived":
+		body = f.archivedBatch(r.URL.Query())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeDiscord) messageBatch(messages []*discordgo.Message, q url.Values) []*discordgo.Message {
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+
+	batch := []*discordgo.Message{}
+	for _, m := range messages {
+		id, _ := strconv.ParseInt(m.ID, 10, 64)
+		if before != 0 && id >= before {
+			continue
+		}
+		batch = append(batch, m)
+		if len(batch) == limit {
+			break
+		}
+	}
+	return batch
+}
+
+// アーカイブ済みのスレッドを、アーカイブされた日時の新しい順に返す
+func (f *fakeDiscord) archivedBatch(q url.Values) *discordgo.ThreadsList {
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	before, _ := time.Parse(time.RFC3339, q.Get("before"))
+
+	var archived []*discordgo.Channel
+	for _, th := range f.threads {
+		if th.ThreadMetadata.Archived && (before.IsZero() || th.ThreadMetadata.ArchiveTimestamp.Before(before)) {
+			archived = append(archived, th)
+		}
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		return archived[i].ThreadMetadata.ArchiveTimestamp.After(archived[j].ThreadMetadata.ArchiveTimestamp)
+	})
+
+	list := &discordgo.ThreadsList{Threads: []*discordgo.Channel{}}
+	for _, th := range archived {
+		if len(list.Threads) == limit {
+			list.HasMore = true
+			break
+		}
+		list.Threads = append(list.Threads, th)
+	}
+	return list
+}
+
+// すべてのリクエストをテストサーバーに向ける RoundTripper
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newFakeSession(t *testing.T, fake *fakeDiscord) *discordgo.Session {
+	t.Helper()
+
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+
+	target, _ := url.Parse(ts.URL)
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client = &http.Client{Transport: &rewriteTransport{target: target}}
+	return s
+}
+
+// from から to まで interval ごとに 1 件ずつメッセージを作る
+func generateMessages(from, to time.Time, interval time.Duration) []*discordgo.Message {
+	var messages []*discordgo.Message
+	for ts := from; ts.Before(to); ts = ts.Add(interval) {
+		id := strconv.FormatInt(snowflakeFromTime(ts), 10)
+		messages = append(messages, &discordgo.Message{
+			ID:      id,
+			Content: "see https://example.com/" + id,
+			Author:  &discordgo.User{ID: "user"},
+		})
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messageID(messages[i]) > messageID(messages[j])
+	})
+	return messages
+}
+
+func TestFetchLinks(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	// 90 日分、10 分おきにメッセージがあるチャンネル (1 日 144 件)
+	channelStart := time.Date(2026, 7, 1, 0, 0, 0, 0, jst)
+	channelEnd := time.Date(2026, 9, 29, 0, 0, 0, 0, jst)
+	messages := generateMessages(channelStart, channelEnd, 10*time.Minute)
+
+	tests := []struct {
+		name      string
+		start     time.Time
+		end       time.Time
+		wantCount int
+		wantCalls int32
+	}{
+		{
+			// 144 件なので 100 件 + 44 件 (期間外に到達して終了)
+			name:      "one day three months ago",
+			start:     time.Date(2026, 7, 2, 0, 0, 0, 0, jst),
+			end:       time.Date(2026, 7, 2, 23, 59, 59, 999999999, jst),
+			wantCount: 144,
+			wantCalls: 2,
+		},
+		{
+			// 144 * 3 = 432 件なので 5 回
+			name:      "three days",
+			start:     time.Date(2026, 8, 10, 0, 0, 0, 0, jst),
+			end:       time.Date(2026, 8, 12, 23, 59, 59, 999999999, jst),
+			wantCount: 432,
+			wantCalls: 5,
+		},
+		{
+			// チャンネル作成前の日付は 1 回の空レスポンスで終了
+			name:      "before channel history",
+			start:     time.Date(2026, 6, 1, 0, 0, 0, 0, jst),
+			end:       time.Date(2026, 6, 1, 23, 59, 59, 999999999, jst),
+			wantCount: 0,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDiscord{messages: messages}
+			s := newFakeSession(t, fake)
+
+			result, err := FetchLinks(s, "channel", tt.start, tt.end, "bot", nil)
+			if err != nil {
+				t.Fatalf("FetchLinks() error = %v", err)
+			}
+			if result.MessageCount != tt.wantCount {
+				t.Errorf("FetchLinks() MessageCount = %d, want %d", result.MessageCount, tt.wantCount)
+			}
+			if len(result.CapturedLinks) != tt.wantCount {
+				t.Errorf("FetchLinks() len(CapturedLinks) = %d, want %d", len(result.CapturedLinks), tt.wantCount)
+			}
+			if got := fake.calls.Load(); got != tt.wantCalls {
+				t.Errorf("FetchLinks() API calls = %d, want %d", got, tt.wantCalls)
+			}
+
+			for i, link := range result.CapturedLinks {
+				if link.PostedAt.Before(tt.start) || link.PostedAt.After(tt.end) {
+					t.Errorf("link %s posted at %v is outside the window", link.URL, link.PostedAt)
+				}
+				if i > 0 && link.PostedAt.Before(result.CapturedLinks[i-1].PostedAt) {
+					t.Errorf("links are not sorted by posted time at %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchLinksSkipsBot(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+
+	messages := generateMessages(start, start.Add(time.Hour), 30*time.Minute)
+	messages[0].Author = &discordgo.User{ID: "bot"}
+
+	s := newFakeSession(t, &fakeDiscord{messages: messages})
+	result, err := FetchLinks(s, "channel", start, end, "bot", nil)
+	if err != nil {
+		t.Fatalf("FetchLinks() error = %v", err)
+	}
+	if result.MessageCount != 1 {
+		t.Errorf("FetchLinks() MessageCount = %d, want 1", result.MessageCount)
+	}
+}
+
+func TestFetchLinksEngagement(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+
+	// ID の降順: 返信 2 件、リンクを含むメッセージ
+	messages := generateMessages(start, start.Add(3*time.Hour), time.Hour)
+	linkMsg := messages[2]
+	linkMsg.Reactions = []*discordgo.MessageReactions{{Count: 3}, {Count: 2}}
+	for _, reply := range messages[:2] {
+		reply.Type = discordgo.MessageTypeReply
+		reply.Content = "いいね"
+		reply.MessageReference = &discordgo.MessageReference{MessageID: linkMsg.ID}
+	}
+
+	s := newFakeSession(t, &fakeDiscord{messages: messages})
+	result, err := FetchLinks(s, "channel", start, end, "bot", nil)
+	if err != nil {
+		t.Fatalf("FetchLinks() error = %v", err)
+	}
+	if len(result.CapturedLinks) != 1 {
+		t.Fatalf("len(CapturedLinks) = %d, want 1", len(result.CapturedLinks))
+	}
+	if l := result.CapturedLinks[0]; l.ReactionCount != 5 || l.ReplyCount != 2 {
+		t.Errorf("ReactionCount = %d, ReplyCount = %d, want 5, 2", l.ReactionCount, l.ReplyCount)
+	}
+}
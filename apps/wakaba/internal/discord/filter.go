@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// FetchLinks で抽出するリンクの条件
+// 空のフィールドは条件にしない
+type LinkFilter struct {
+	AuthorID       string   // 投稿したユーザー
+	IncludeDomains []string // いずれかのドメイン (サブドメインを含む) のリンクだけを対象にする
+	ExcludeDomains []string // 対象にしないドメイン (サブドメインを含む)
+	Keyword        string   // メッセージの本文かリンク先のタイトルに含まれる文字列 (大文字小文字・全角半角を区別しない)
+
+	// メッセージにキーワードが含まれないリンクについて、リンク先のタイトルを links と同じ順に返す
+	// nil の場合はメッセージだけでキーワードを判定する
+	Titles func(links []CapturedLink) []string
+}
+
+// 条件が 1 つでも指定されているか
+func (f *LinkFilter) Active() bool {
+	return f != nil && (f.AuthorID != "" || len(f.IncludeDomains) > 0 || len(f.ExcludeDomains) > 0 || f.Keyword != "")
+}
+
+// "github.com, example.org" のようなカンマ・空白区切りのドメインの一覧を解釈する
+// "https://www.github.com/" のように URL で指定されたものはホスト名にする
+func ParseDomainList(input string) []string {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == '、' || r == ' ' || r == '　'
+	})
+	var domains []string
+	for _, f := range fields {
+		if u, err := url.Parse(f); err == nil && u.Host != "" {
+			f = u.Hostname()
+		}
+		f = strings.TrimPrefix(strings.Trim(strings.ToLower(f), "./"), "www.")
+		if f != "" {
+			domains = append(domains, f)
+		}
+	}
+	return domains
+}
+
+func (f *LinkFilter) matchAuthor(m *discordgo.Message) bool {
+	if f == nil || f.AuthorID == "" {
+		return true
+	}
+	return m.Author != nil && m.Author.ID == f.AuthorID
+}
+
+func (f *LinkFilter) matchDomain(rawURL string) bool {
+	if f == nil || (len(f.IncludeDomains) == 0 && len(f.ExcludeDomains) == 0) {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	for _, d := range f.ExcludeDomains {
+		if hostInDomain(host, d) {
+			return false
+		}
+	}
+	if len(f.IncludeDomains) == 0 {
+		return true
+	}
+	for _, d := range f.IncludeDomains {
+		if hostInDomain(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// host が domain そのものか、そのサブドメインか
+func hostInDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// text にキーワードが含まれるか
+func (f *LinkFilter) matchKeyword(text string) bool {
+	if f == nil || f.Keyword == "" {
+		return true
+	}
+	return strings.Contains(foldText(text), foldText(f.Keyword))
+}
+
+// キーワードを探すメッセージのテキスト (本文、Embed、転送されたメッセージの本文)
+func messageText(m *discordgo.Message) string {
+	parts := []string{m.Content}
+	for _, e := range m.Embeds {
+		if e == nil {
+			continue
+		}
+		parts = append(parts, e.Title, e.Description)
+		for _, field := range e.Fields {
+			if field != nil {
+				parts = append(parts, field.Name, field.Value)
+			}
+		}
+	}
+	for _, snapshot := range m.MessageSnapshots {
+		if snapshot.Message != nil {
+			parts = append(parts, snapshot.Message.Content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// 全角の英数字・記号を半角にし、小文字にする
+func foldText(s string) string {
+	return strings.ToLower(strings.Map(func(r rune) rune {
+		if r >= '！' && r <= '～' {
+			return r - '！' + '!'
+		}
+		if r == '　' {
+			return ' '
+		}
+		return r
+	}, s))
+}
@@ -0,0 +1,139 @@
+package discord
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseDomainList(t *testing.T) {
+	got := ParseDomainList("GitHub.com, https://www.example.org/path　.tenor.com、")
+	want := []string{"github.com", "example.org", "tenor.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDomainList() = %v, want %v", got, want)
+	}
+	if got := ParseDomainList(" "); got != nil {
+		t.Errorf("ParseDomainList(blank) = %v, want nil", got)
+	}
+}
+
+func TestLinkFilterMatchDomain(t *testing.T) {
+	f := &LinkFilter{IncludeDomains: []string{"github.com", "example.org"}, ExcludeDomains: []string{"gist.github.com"}}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://github.com/yotu/wakaba", want: true},
+		{url: "https://API.GitHub.com/repos", want: true},
+		{url: "https://gist.github.com/abc", want: false},
+		{url: "https://notgithub.com/", want: false},
+		{url: "https://example.org./", want: true},
+		{url: "https://tenor.com/view/1", want: false},
+	}
+	for _, tt := range tests {
+		if got := f.matchDomain(tt.url); got != tt.want {
+			t.Errorf("matchDomain(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	exclude := &LinkFilter{ExcludeDomains: []string{"tenor.com"}}
+	if exclude.matchDomain("https://media.tenor.com/x.gif") || !exclude.matchDomain("https://github.com/") {
+		t.Error("exclude-only filter should drop tenor.com and keep others")
+	}
+}
+
+func TestFetchLinksFilter(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+
+	msg := func(hour int, author, content string) *discordgo.Message {
+		ts := start.Add(time.Duration(hour) * time.Hour)
+		return &discordgo.Message{
+			ID:      strconv.FormatInt(snowflakeFromTime(ts), 10),
+			Content: content,
+			Author:  &discordgo.User{ID: author},
+		}
+	}
+	// ID の降順
+	messages := []*discordgo.Message{
+		msg(5, "bob", "https://tenor.com/view/funny"),
+		msg(4, "alice", "https://blog.example/post"),
+		msg(3, "alice", "ＧＯ 1.27 のリリースノート https://go.dev/doc/go1.27"),
+		msg(2, "bob", "https://github.com/golang/go https://example.com/"),
+		msg(1, "alice", "読んで https://github.com/yotu/wakaba"),
+	}
+	s := newFakeSession(t, &fakeDiscord{messages: messages})
+
+	fetch := func(t *testing.T, filter *LinkFilter) *FetchResult {
+		t.Helper()
+		result, err := FetchLinks(s, "channel", start, end, "bot", &FetchOptions{Filter: filter})
+		if err != nil {
+			t.Fatalf("FetchLinks() error = %v", err)
+		}
+		return result
+	}
+	urls := func(r *FetchResult) []string {
+		var got []string
+		for _, l := range r.CapturedLinks {
+			got = append(got, l.URL)
+		}
+		return got
+	}
+
+	t.Run("author", func(t *testing.T) {
+		r := fetch(t, &LinkFilter{AuthorID: "bob"})
+		if want := []string{"https://github.com/golang/go", "https://example.com/", "https://tenor.com/view/funny"}; !reflect.DeepEqual(urls(r), want) {
+			t.Errorf("urls = %v, want %v", urls(r), want)
+		}
+		// 検索した数と一致した数を分けて数える
+		if r.MessageCount != 5 || r.ScannedLinkCount != 6 || r.MatchedMessageCount != 2 {
+			t.Errorf("MessageCount = %d, ScannedLinkCount = %d, MatchedMessageCount = %d, want 5, 6, 2", r.MessageCount, r.ScannedLinkCount, r.MatchedMessageCount)
+		}
+	})
+
+	t.Run("domain", func(t *testing.T) {
+		r := fetch(t, &LinkFilter{IncludeDomains: []string{"github.com"}})
+		if want := []string{"https://github.com/yotu/wakaba", "https://github.com/golang/go"}; !reflect.DeepEqual(urls(r), want) {
+			t.Errorf("urls = %v, want %v", urls(r), want)
+		}
+		r = fetch(t, &LinkFilter{ExcludeDomains: []string{"tenor.com", "github.com"}})
+		if want := []string{"https://example.com/", "https://go.dev/doc/go1.27", "https://blog.example/post"}; !reflect.DeepEqual(urls(r), want) {
+			t.Errorf("urls = %v, want %v", urls(r), want)
+		}
+	})
+
+	t.Run("keyword in message", func(t *testing.T) {
+		r := fetch(t, &LinkFilter{Keyword: "go 1.27"})
+		if want := []string{"https://go.dev/doc/go1.27"}; !reflect.DeepEqual(urls(r), want) {
+			t.Errorf("urls = %v, want %v", urls(r), want)
+		}
+	})
+
+	t.Run("keyword in title", func(t *testing.T) {
+		var asked []string
+		r := fetch(t, &LinkFilter{
+			Keyword: "Wakaba",
+			Titles: func(links []CapturedLink) []string {
+				titles := make([]string, len(links))
+				for i, l := range links {
+					asked = append(asked, l.URL)
+					if l.URL == "https://blog.example/post" {
+						titles[i] = "Introducing wakaba"
+					}
+				}
+				return titles
+			},
+		})
+		// メッセージに含まれる場合はタイトルを調べない
+		if want := []string{"https://github.com/yotu/wakaba", "https://blog.example/post"}; !reflect.DeepEqual(urls(r), want) {
+			t.Errorf("urls = %v, want %v", urls(r), want)
+		}
+		if len(asked) != 5 {
+			t.Errorf("titles asked for %v, want 5 links", asked)
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// /summarize の対象にするチャンネルの範囲
+type Scope string
+
+const (
+	ScopeChannel  Scope = "channel"  // コマンドを実行したチャンネル
+	ScopeCategory Scope = "category" // コマンドを実行したチャンネルと同じカテゴリのチャンネル
+	ScopeGuild    Scope = "guild"    // サーバーのすべてのチャンネル
+)
+
+// カテゴリ・サーバー全体を対象にする場合に、同時にメッセージを取得するチャンネル数
+// discordgo がチャンネルごとのレート制限を待つので、ここでは同時実行数だけを抑える
+const scopeWorkers = 4
+
+// カテゴリ・サーバー全体を対象にする場合のチャンネル数の上限
+const maxScopeChannels = 100
+
+// メッセージを読むのに必要な権限
+const ReadPermissions = discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory
+
+// scope で指定された範囲のチャンネルのメッセージからリンクを抽出する
+// コマンドを実行したユーザー (userID) とボットの両方が読めるチャンネルだけを対象にする
+// ユーザーは読めるがボットに権限のないチャンネルは取得せず、SkippedChannels に名前を入れる
+// リンクはチャンネルの並び順にまとめて返す
+func FetchScopeLinks(s *discordgo.Session, guildID, channelID string, scope Scope, start, end time.Time, botID, userID string, opts *FetchOptions) (*FetchResult, error) {
+	if scope == "" || scope == ScopeChannel {
+		return FetchLinks(s, channelID, start, end, botID, opts)
+	}
+	if guildID == "" {
+		return nil, errors.New("category and guild scopes are only available in a server")
+	}
+	if userID == "" {
+		return nil, errors.New("category and guild scopes require the invoking user")
+	}
+
+	includeThreads := opts != nil && opts.IncludeThreads
+	channels, skipped, err := listScopeChannels(s, guildID, channelID, scope, botID, userID, includeThreads)
+	if err != nil {
+		return nil, err
+	}
+	result := &FetchResult{SkippedChannels: skipped}
+	if len(channels) > maxScopeChannels {
+		channels, result.ChannelsTruncated = channels[:maxScopeChannels], true
+	}
+
+	results := make([]*FetchResult, len(channels))
+	errs := make([]error, len(channels))
+	sem := make(chan struct{}, scopeWorkers)
+	var wg sync.WaitGroup
+	for i, ch := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = FetchLinks(s, ch.ID, start, end, botID, opts)
+		}()
+	}
+	wg.Wait()
+
+	for i, ch := range channels {
+		if errs[i] != nil {
+			// 権限の計算では読めるはずでも 403 になった場合は、権限のないチャンネルとして扱う
+			if isForbidden(errs[i]) {
+				result.SkippedChannels = append(result.SkippedChannels, ch.Name)
+				continue
+			}
+			return nil, fmt.Errorf("#%s: %w", ch.Name, errs[i])
+		}
+		r := results[i]
+		for _, link := range r.CapturedLinks {
+			link.ChannelName = ch.Name
+			result.CapturedLinks = append(result.CapturedLinks, link)
+		}
+		result.MessageCount += r.MessageCount
+		result.ScannedLinkCount += r.ScannedLinkCount
+		result.MatchedMessageCount += r.MatchedMessageCount
+		result.ThreadCount += r.ThreadCount
+		result.ThreadsTruncated = result.ThreadsTruncated || r.ThreadsTruncated
+		result.ChannelCount++
+	}
+	return result, nil
+}
+
+// scope に含まれるチャンネルのうち、ユーザーが読めるものを、ボットも読めるものとボットに権限がないもの (名前) に分けて返す
+// ユーザーが読めないチャンネルは名前も返さない
+func listScopeChannels(s *discordgo.Session, guildID, channelID string, scope Scope, botID, userID string, includeThreads bool) ([]*discordgo.Channel, []string, error) {
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := s.GuildChannels(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, err := s.GuildMember(guildID, botID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID := map[string]*discordgo.Channel{}
+	for _, ch := range all {
+		byID[ch.ID] = ch
+	}
+
+	categoryID := ""
+	if scope == ScopeCategory {
+		current, ok := byID[channelID]
+		if !ok {
+			// スレッドは一覧に含まれないので、親チャンネルのカテゴリを使う
+			if current, err = s.Channel(channelID); err != nil {
+				return nil, nil, err
+			}
+			if parent, ok := byID[current.ParentID]; ok && current.IsThread() {
+				current = parent
+			}
+		}
+		if current.ParentID == "" {
+			return nil, nil, errors.New("this channel does not belong to a category")
+		}
+		categoryID = current.ParentID
+	}
+
+	var channels []*discordgo.Channel
+	var skipped []string
+	for _, ch := range all {
+		if !hasMessages(ch, includeThreads) {
+			continue
+		}
+		if scope == ScopeCategory && ch.ParentID != categoryID {
+			continue
+		}
+		if channelPermissions(guild, ch, user)&ReadPermissions != ReadPermissions {
+			continue
+		}
+		if channelPermissions(guild, ch, member)&ReadPermissions != ReadPermissions {
+			skipped = append(skipped, ch.Name)
+			continue
+		}
+		channels = append(channels, ch)
+	}
+
+	// Discord の表示と同じく、カテゴリの並び順、チャンネルの並び順にする
+	position := func(ch *discordgo.Channel) (int, int) {
+		if parent, ok := byID[ch.ParentID]; ok {
+			return parent.Position, ch.Position
+		}
+		return -1, ch.Position
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		pi, ci := position(channels[i])
+		pj, cj := position(channels[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return ci < cj
+	})
+	return channels, skipped, nil
+}
+
+// メッセージを投稿できる種類のチャンネルか
+// フォーラムはスレッド (投稿) も対象にする場合だけ含める
+func hasMessages(ch *discordgo.Channel, includeThreads bool) bool {
+	switch ch.Type {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildVoice:
+		return true
+	case discordgo.ChannelTypeGuildForum, discordgo.ChannelTypeGuildMedia:
+		return includeThreads
+	}
+	return false
+}
+
+// メンバーのチャンネルでの権限を、ロールと権限の上書きから計算する
+// https://discord.com/developers/docs/topics/permissions#permission-overwrites
+func channelPermissions(guild *discordgo.Guild, ch *discordgo.Channel, member *discordgo.Member) int64 {
+	if member.User != nil && guild.OwnerID == member.User.ID {
+		return discordgo.PermissionAll
+	}
+
+	var perms int64
+	for _, role := range guild.Roles {
+		// @everyone ロールの ID はサーバーの ID と同じ
+		if role.ID == guild.ID || slices.Contains(member.Roles, role.ID) {
+			perms |= role.Permissions
+		}
+	}
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return discordgo.PermissionAll
+	}
+
+	var roleAllow, roleDeny int64
+	for _, o := range ch.PermissionOverwrites {
+		switch {
+		case o.Type == discordgo.PermissionOverwriteTypeRole && o.ID == guild.ID:
+			perms = perms&^o.Deny | o.Allow
+		case o.Type == discordgo.PermissionOverwriteTypeRole && slices.Contains(member.Roles, o.ID):
+			roleAllow |= o.Allow
+			roleDeny |= o.Deny
+		}
+	}
+	perms = perms&^roleDeny | roleAllow
+
+	for _, o := range ch.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeMember && member.User != nil && o.ID == member.User.ID {
+			perms = perms&^o.Deny | o.Allow
+		}
+	}
+	return perms
+}
+
+// ユーザーのチャンネルでの権限を返す
+// スレッドの場合は親チャンネルの権限を返す
+func ChannelPermissions(s *discordgo.Session, guildID, channelID, userID string) (int64, error) {
+	ch, err := s.Channel(channelID)
+	if err != nil {
+		return 0, err
+	}
+	if ch.GuildID != guildID {
+		return 0, fmt.Errorf("channel %s is not in guild %s", channelID, guildID)
+	}
+	if ch.IsThread() {
+		if ch, err = s.Channel(ch.ParentID); err != nil {
+			return 0, err
+		}
+	}
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return 0, err
+	}
+	member, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return channelPermissions(guild, ch, member), nil
+}
+
+// 権限不足 (403 Forbidden) による失敗か
+func isForbidden(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusForbidden
+}
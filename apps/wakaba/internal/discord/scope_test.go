@@ -0,0 +1,213 @@
+package discord
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestChannelPermissions(t *testing.T) {
+	guild := &discordgo.Guild{
+		ID:      "guild",
+		OwnerID: "owner",
+		Roles: []*discordgo.Role{
+			{ID: "guild", Permissions: ReadPermissions},
+			{ID: "bots", Permissions: discordgo.PermissionSendMessages},
+			{ID: "admin", Permissions: discordgo.PermissionAdministrator},
+		},
+	}
+	bot := &discordgo.Member{User: &discordgo.User{ID: "bot"}, Roles: []string{"bots"}}
+	deny := func(id string, typ discordgo.PermissionOverwriteType) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: typ, Deny: discordgo.PermissionViewChannel}
+	}
+	allow := func(id string, typ discordgo.PermissionOverwriteType) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: typ, Allow: discordgo.PermissionViewChannel}
+	}
+
+	tests := []struct {
+		name       string
+		member     *discordgo.Member
+		overwrites []*discordgo.PermissionOverwrite
+		want       bool
+	}{
+		{name: "everyone can read", member: bot, want: true},
+		{name: "everyone denied", member: bot, overwrites: []*discordgo.PermissionOverwrite{deny("guild", discordgo.PermissionOverwriteTypeRole)}, want: false},
+		{
+			name:   "role allow overrides everyone deny",
+			member: bot,
+			// 並び順に関係なく @everyone の上書きが先に適用される
+			overwrites: []*discordgo.PermissionOverwrite{allow("bots", discordgo.PermissionOverwriteTypeRole), deny("guild", discordgo.PermissionOverwriteTypeRole)},
+			want:       true,
+		},
+		{
+			name:       "member deny overrides role allow",
+			member:     bot,
+			overwrites: []*discordgo.PermissionOverwrite{allow("bots", discordgo.PermissionOverwriteTypeRole), deny("bot", discordgo.PermissionOverwriteTypeMember)},
+			want:       false,
+		},
+		{
+			name:       "administrator ignores overwrites",
+			member:     &discordgo.Member{User: &discordgo.User{ID: "bot"}, Roles: []string{"admin"}},
+			overwrites: []*discordgo.PermissionOverwrite{deny("bot", discordgo.PermissionOverwriteTypeMember)},
+			want:       true,
+		},
+		{
+			name:       "owner ignores overwrites",
+			member:     &discordgo.Member{User: &discordgo.User{ID: "owner"}},
+			overwrites: []*discordgo.PermissionOverwrite{deny("guild", discordgo.PermissionOverwriteTypeRole)},
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &discordgo.Channel{ID: "channel", PermissionOverwrites: tt.overwrites}
+			got := channelPermissions(guild, ch, tt.member)&ReadPermissions == ReadPermissions
+			if got != tt.want {
+				t.Errorf("can read = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchScopeLinks(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+
+	text := func(id, name, parentID string, position int) *discordgo.Channel {
+		return &discordgo.Channel{ID: id, Name: name, ParentID: parentID, Position: position, Type: discordgo.ChannelTypeGuildText}
+	}
+	// ボットは読めるが、staff ロールのないユーザーは読めないチャンネル
+	private := text("private", "private", "cat-a", 2)
+	private.PermissionOverwrites = []*discordgo.PermissionOverwrite{
+		{ID: "guild", Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+		{ID: "staff", Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionViewChannel},
+	}
+	// ユーザーは読めるが、ボットは読めないチャンネル
+	botDenied := text("bot-denied", "bot-denied", "cat-a", 4)
+	botDenied.PermissionOverwrites = []*discordgo.PermissionOverwrite{{ID: "bot", Type: discordgo.PermissionOverwriteTypeMember, Deny: discordgo.PermissionViewChannel}}
+
+	messages := func() []*discordgo.Message {
+		return generateMessages(start.Add(time.Hour), start.Add(2*time.Hour), time.Hour)
+	}
+	fake := &fakeDiscord{
+		guild: &discordgo.Guild{ID: "guild", Roles: []*discordgo.Role{{ID: "guild", Permissions: ReadPermissions}, {ID: "staff"}}},
+		members: map[string]*discordgo.Member{
+			"bot":   {User: &discordgo.User{ID: "bot"}, Roles: []string{"staff"}},
+			"user":  {User: &discordgo.User{ID: "user"}},
+			"staff": {User: &discordgo.User{ID: "staff"}, Roles: []string{"staff"}},
+		},
+		channels: []*discordgo.Channel{
+			{ID: "cat-b", Name: "B", Type: discordgo.ChannelTypeGuildCategory, Position: 1},
+			{ID: "cat-a", Name: "A", Type: discordgo.ChannelTypeGuildCategory, Position: 0},
+			text("b-general", "b-general", "cat-b", 0),
+			text("a-second", "a-second", "cat-a", 1),
+			text("a-first", "a-first", "cat-a", 0),
+			text("broken", "broken", "cat-a", 3),
+			private,
+			botDenied,
+			{ID: "forum", Name: "forum", ParentID: "cat-a", Type: discordgo.ChannelTypeGuildForum},
+		},
+		threadMessages: map[string][]*discordgo.Message{
+			"b-general": messages(),
+			"a-second":  messages(),
+			"a-first":   messages(),
+			"private":   messages(),
+		},
+		forbidden: map[string]bool{"broken": true},
+	}
+	s := newFakeSession(t, fake)
+
+	t.Run("guild", func(t *testing.T) {
+		result, err := FetchScopeLinks(s, "guild", "a-first", ScopeGuild, start, end, "bot", "user", nil)
+		if err != nil {
+			t.Fatalf("FetchScopeLinks() error = %v", err)
+		}
+
+		// カテゴリの並び順、チャンネルの並び順にまとめる
+		var got []string
+		for _, l := range result.CapturedLinks {
+			got = append(got, l.ChannelName)
+		}
+		if want := []string{"a-first", "a-second", "b-general"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("channels = %v, want %v", got, want)
+		}
+		// ユーザーが読めない private は、リンクも名前も含めない
+		if want := []string{"bot-denied", "broken"}; !reflect.DeepEqual(result.SkippedChannels, want) {
+			t.Errorf("SkippedChannels = %v, want %v", result.SkippedChannels, want)
+		}
+		if result.ChannelCount != 3 || result.MessageCount != 3 {
+			t.Errorf("ChannelCount = %d, MessageCount = %d, want 3, 3", result.ChannelCount, result.MessageCount)
+		}
+	})
+
+	t.Run("invoker can read private", func(t *testing.T) {
+		result, err := FetchScopeLinks(s, "guild", "a-first", ScopeGuild, start, end, "bot", "staff", nil)
+		if err != nil {
+			t.Fatalf("FetchScopeLinks() error = %v", err)
+		}
+		var got []string
+		for _, l := range result.CapturedLinks {
+			got = append(got, l.ChannelName)
+		}
+		if want := []string{"a-first", "a-second", "private", "b-general"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("channels = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("no invoker", func(t *testing.T) {
+		if _, err := FetchScopeLinks(s, "guild", "a-first", ScopeGuild, start, end, "bot", "", nil); err == nil {
+			t.Error("FetchScopeLinks() without user error = nil, want error")
+		}
+	})
+
+	t.Run("category", func(t *testing.T) {
+		result, err := FetchScopeLinks(s, "guild", "b-general", ScopeCategory, start, end, "bot", "user", nil)
+		if err != nil {
+			t.Fatalf("FetchScopeLinks() error = %v", err)
+		}
+		if len(result.CapturedLinks) != 1 || result.CapturedLinks[0].ChannelName != "b-general" || len(result.SkippedChannels) != 0 {
+			t.Errorf("FetchScopeLinks(category) = %+v", result)
+		}
+	})
+
+	t.Run("dm", func(t *testing.T) {
+		if _, err := FetchScopeLinks(s, "", "dm", ScopeGuild, start, end, "bot", "user", nil); err == nil {
+			t.Error("FetchScopeLinks() in DM error = nil, want error")
+		}
+	})
+}
+
+func TestChannelPermissionsLookup(t *testing.T) {
+	private := &discordgo.Channel{ID: "private", GuildID: "guild", Type: discordgo.ChannelTypeGuildText, PermissionOverwrites: []*discordgo.PermissionOverwrite{
+		{ID: "guild", Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+		{ID: "staff", Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionViewChannel},
+	}}
+	fake := &fakeDiscord{
+		guild:   &discordgo.Guild{ID: "guild", Roles: []*discordgo.Role{{ID: "guild", Permissions: ReadPermissions}, {ID: "staff"}}},
+		channel: private,
+		member:  &discordgo.Member{User: &discordgo.User{ID: "user"}},
+	}
+	s := newFakeSession(t, fake)
+
+	perms, err := ChannelPermissions(s, "guild", "private", "user")
+	if err != nil {
+		t.Fatalf("ChannelPermissions() error = %v", err)
+	}
+	if perms&ReadPermissions == ReadPermissions {
+		t.Errorf("ChannelPermissions() = %b, want no view permission", perms)
+	}
+
+	fake.member.Roles = []string{"staff"}
+	if perms, err := ChannelPermissions(s, "guild", "private", "user"); err != nil || perms&ReadPermissions != ReadPermissions {
+		t.Errorf("ChannelPermissions(staff) = %b, %v, want read permissions", perms, err)
+	}
+
+	// 他のサーバーのチャンネルは指定できない
+	if _, err := ChannelPermissions(s, "other", "private", "user"); err == nil {
+		t.Error("ChannelPermissions(other guild) should fail")
+	}
+}
@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+// リンクを抽出するメッセージ内の場所
+type LinkSource string
+
+const (
+	SourceContent     LinkSource = "content"     // メッセージ本文
+	SourceEmbeds      LinkSource = "embeds"      // Webhook やボットが投稿した Embed
+	SourceAttachments LinkSource = "attachments" // アップロードされたファイル
+	SourceForwards    LinkSource = "forwards"    // 転送されたメッセージ
+	SourceReplies     LinkSource = "replies"     // 期間外のメッセージへの返信で、返信先にあるもの
+)
+
+// sources を指定しない場合に抽出する場所
+var DefaultLinkSources = []LinkSource{SourceContent, SourceEmbeds, SourceAttachments, SourceForwards}
+
+var allLinkSources = []LinkSource{SourceContent, SourceEmbeds, SourceAttachments, SourceForwards, SourceReplies}
+
+// "content,embeds" のようなカンマ・空白区切りの文字列を解釈する
+// 空文字列の場合は DefaultLinkSources を返す
+func ParseLinkSources(input string) ([]LinkSource, error) {
+	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return r == ',' || r == '、' || r == ' ' || r == '　'
+	})
+	if len(fields) == 0 {
+		return DefaultLinkSources, nil
+	}
+
+	var sources []LinkSource
+	for _, f := range fields {
+		source := LinkSource(f)
+		if !slices.Contains(allLinkSources, source) {
+			return nil, fmt.Errorf("unknown source: %s", f)
+		}
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// メッセージから sources で指定された場所のリンクを抽出する
+// 同じメッセージ内で同じ URL が複数の場所にある場合は、最初に見つかったものだけを返す
+func extractMessageLinks(m *discordgo.Message, sources []LinkSource, startID int64) []CapturedLink {
+	var links []CapturedLink
+	seen := map[string]bool{}
+	add := func(origin LinkSource, found []util.ExtractedLink) {
+		for _, l := range found {
+			if seen[l.URL] {
+				continue
+			}
+			seen[l.URL] = true
+			links = append(links, CapturedLink{URL: l.URL, Label: l.Label, Origin: origin})
+		}
+	}
+
+	if slices.Contains(sources, SourceContent) {
+		add(SourceContent, util.ExtractLinks(m.Content))
+	}
+	if slices.Contains(sources, SourceEmbeds) {
+		add(SourceEmbeds, embedLinks(m.Embeds))
+	}
+	if slices.Contains(sources, SourceAttachments) {
+		add(SourceAttachments, attachmentLinks(m.Attachments))
+	}
+	if slices.Contains(sources, SourceForwards) {
+		for _, snapshot := range m.MessageSnapshots {
+			if snapshot.Message == nil {
+				continue
+			}
+			f := snapshot.Message
+			add(SourceForwards, util.ExtractLinks(f.Content))
+			add(SourceForwards, embedLinks(f.Embeds))
+			add(SourceForwards, attachmentLinks(f.Attachments))
+		}
+	}
+	// 期間内の返信先は、そのメッセージ自体から抽出されるので対象外
+	if slices.Contains(sources, SourceReplies) && m.Type == discordgo.MessageTypeReply && m.ReferencedMessage != nil {
+		if ref := m.ReferencedMessage; messageID(ref) < startID {
+			add(SourceReplies, util.ExtractLinks(ref.Content))
+			add(SourceReplies, embedLinks(ref.Embeds))
+		}
+	}
+	return links
+}
+
+// Embed からリンクを抽出する
+// 本文の URL から Discord が自動生成したプレビュー (rich 以外) は本文と重複するので対象外
+func embedLinks(embeds []*discordgo.MessageEmbed) []util.ExtractedLink {
+	var links []util.ExtractedLink
+	for _, e := range embeds {
+		if e == nil || (e.Type != "" && e.Type != discordgo.EmbedTypeRich) {
+			continue
+		}
+		if e.URL != "" {
+			links = append(links, util.ExtractedLink{URL: e.URL, Label: e.Title})
+		}
+		links = append(links, util.ExtractLinks(e.Description)...)
+		for _, field := range e.Fields {
+			if field != nil {
+				links = append(links, util.ExtractLinks(field.Value)...)
+			}
+		}
+	}
+	return links
+}
+
+// 添付ファイルの URL をファイル名つきで返す
+func attachmentLinks(attachments []*discordgo.MessageAttachment) []util.ExtractedLink {
+	var links []util.ExtractedLink
+	for _, a := range attachments {
+		if a != nil && a.URL != "" {
+			links = append(links, util.ExtractedLink{URL: a.URL, Label: a.Filename})
+		}
+	}
+	return links
+}
@@ -0,0 +1,126 @@
+package discord
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseLinkSources(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []LinkSource
+		wantErr bool
+	}{
+		{input: "", want: DefaultLinkSources},
+		{input: "content", want: []LinkSource{SourceContent}},
+		{input: "Embeds, attachments", want: []LinkSource{SourceEmbeds, SourceAttachments}},
+		{input: "forwards replies forwards", want: []LinkSource{SourceForwards, SourceReplies}},
+		{input: "content、embeds", want: []LinkSource{SourceContent, SourceEmbeds}},
+		{input: "content,stickers", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLinkSources(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLinkSources(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLinkSources(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMessageLinks(t *testing.T) {
+	startID := snowflakeFromTime(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC))
+	oldID := strconv.FormatInt(startID-1, 10)
+
+	m := &discordgo.Message{
+		Type:    discordgo.MessageTypeReply,
+		Content: "see https://example.com/content and [docs](https://example.com/docs)",
+		Embeds: []*discordgo.MessageEmbed{
+			// 本文の URL から自動生成されたプレビューは対象外
+			{Type: discordgo.EmbedTypeLink, URL: "https://example.com/content", Title: "auto"},
+			{
+				Type:        discordgo.EmbedTypeRich,
+				URL:         "https://feed.example/article",
+				Title:       "New article",
+				Description: "also https://feed.example/related and https://example.com/content",
+				Fields:      []*discordgo.MessageEmbedField{{Name: "source", Value: "<https://feed.example/source>"}},
+			},
+		},
+		Attachments: []*discordgo.MessageAttachment{
+			{URL: "https://cdn.discordapp.com/attachments/1/2/report.pdf", Filename: "report.pdf"},
+		},
+		MessageSnapshots: []discordgo.MessageSnapshot{
+			{Message: &discordgo.Message{
+				Content: "forwarded https://forward.example/",
+				Embeds:  []*discordgo.MessageEmbed{{URL: "https://forward.example/embed"}},
+			}},
+		},
+		ReferencedMessage: &discordgo.Message{ID: oldID, Content: "old https://reply.example/"},
+	}
+
+	all := []LinkSource{SourceContent, SourceEmbeds, SourceAttachments, SourceForwards, SourceReplies}
+	want := []CapturedLink{
+		{URL: "https://example.com/content", Origin: SourceContent},
+		{URL: "https://example.com/docs", Label: "docs", Origin: SourceContent},
+		{URL: "https://feed.example/article", Label: "New article", Origin: SourceEmbeds},
+		{URL: "https://feed.example/related", Origin: SourceEmbeds},
+		{URL: "https://feed.example/source", Origin: SourceEmbeds},
+		{URL: "https://cdn.discordapp.com/attachments/1/2/report.pdf", Label: "report.pdf", Origin: SourceAttachments},
+		{URL: "https://forward.example/", Origin: SourceForwards},
+		{URL: "https://forward.example/embed", Origin: SourceForwards},
+		{URL: "https://reply.example/", Origin: SourceReplies},
+	}
+	if got := extractMessageLinks(m, all, startID); !reflect.DeepEqual(got, want) {
+		t.Errorf("extractMessageLinks(all) =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// 指定しなかった場所からは抽出しない
+	got := extractMessageLinks(m, []LinkSource{SourceAttachments}, startID)
+	if len(got) != 1 || got[0].Origin != SourceAttachments {
+		t.Errorf("extractMessageLinks(attachments) = %+v", got)
+	}
+
+	// 返信先が期間内の場合は、返信先のメッセージから抽出されるので対象外
+	m.ReferencedMessage.ID = strconv.FormatInt(startID+1, 10)
+	if got := extractMessageLinks(m, []LinkSource{SourceReplies}, startID); len(got) != 0 {
+		t.Errorf("extractMessageLinks(replies in range) = %+v, want none", got)
+	}
+}
+
+func TestFetchLinksSources(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+
+	// RSS ボットの Webhook が投稿した Embed だけのメッセージ
+	messages := generateMessages(start, start.Add(time.Hour), time.Hour)
+	messages[0].Content = ""
+	messages[0].Author = &discordgo.User{ID: "webhook", Bot: true}
+	messages[0].Embeds = []*discordgo.MessageEmbed{{Type: discordgo.EmbedTypeRich, URL: "https://feed.example/1", Title: "Feed"}}
+
+	s := newFakeSession(t, &fakeDiscord{messages: messages})
+
+	result, err := FetchLinks(s, "channel", start, end, "bot", nil)
+	if err != nil {
+		t.Fatalf("FetchLinks() error = %v", err)
+	}
+	if len(result.CapturedLinks) != 1 || result.CapturedLinks[0].URL != "https://feed.example/1" || result.CapturedLinks[0].Origin != SourceEmbeds {
+		t.Errorf("FetchLinks() CapturedLinks = %+v", result.CapturedLinks)
+	}
+
+	result, err = FetchLinks(s, "channel", start, end, "bot", &FetchOptions{Sources: []LinkSource{SourceContent}})
+	if err != nil {
+		t.Fatalf("FetchLinks() error = %v", err)
+	}
+	if len(result.CapturedLinks) != 0 {
+		t.Errorf("FetchLinks(content) CapturedLinks = %+v, want none", result.CapturedLinks)
+	}
+}
@@ -0,0 +1,106 @@
+package discord
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// include_threads で対象にするスレッドの上限
+// スレッドごとに少なくとも 1 回 API を呼ぶため、Lambda の実行時間に収まるように制限する
+const maxThreads = 50
+
+// ThreadsArchived で一度に取得できる最大件数
+const threadsPerRequest = 100
+
+func isForum(ch *discordgo.Channel) bool {
+	return ch.Type == discordgo.ChannelTypeGuildForum || ch.Type == discordgo.ChannelTypeGuildMedia
+}
+
+// チャンネルのスレッドのうち、startID 以上 endID 未満のメッセージがありうるものを作成順に返す
+// アクティブな公開スレッドと、公開アーカイブ済みのスレッドが対象
+// プライベートスレッドは参加者しか読めないので含めない
+// maxThreads を超えた場合は新しいものから対象外にし、truncated を true にする
+func listThreads(s *discordgo.Session, parent *discordgo.Channel, startID, endID int64) (threads []*discordgo.Channel, truncated bool, err error) {
+	// DM にはスレッドがない
+	if parent.GuildID == "" {
+		return nil, false, nil
+	}
+
+	seen := map[string]bool{}
+	add := func(th *discordgo.Channel) {
+		if th.ParentID != parent.ID || th.Type == discordgo.ChannelTypeGuildPrivateThread || seen[th.ID] || !threadInWindow(th, startID, endID) {
+			return
+		}
+		seen[th.ID] = true
+		threads = append(threads, th)
+	}
+
+	// アクティブなスレッドはサーバー全体でまとめて返される
+	active, err := s.GuildThreadsActive(parent.GuildID)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, th := range active.Threads {
+		add(th)
+	}
+
+	// アーカイブ済みのスレッドはアーカイブされた日時の新しい順に返される
+	// start より前にアーカイブされたスレッドには期間内のメッセージがないので、そこで打ち切る
+	start := time.UnixMilli((startID >> 22) + discordEpoch)
+	var before *time.Time
+	for {
+		archived, err := s.ThreadsArchived(parent.ID, before, threadsPerRequest)
+		if err != nil {
+			return nil, false, err
+		}
+
+		reachedStart := false
+		for _, th := range archived.Threads {
+			if th.ThreadMetadata != nil && th.ThreadMetadata.ArchiveTimestamp.Before(start) {
+				reachedStart = true
+				break
+			}
+			add(th)
+		}
+
+		if reachedStart || !archived.HasMore || len(archived.Threads) == 0 {
+			break
+		}
+		last := archived.Threads[len(archived.Threads)-1]
+		if last.ThreadMetadata == nil {
+			break
+		}
+		ts := last.ThreadMetadata.ArchiveTimestamp
+		before = &ts
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return snowflakeOf(threads[i]) < snowflakeOf(threads[j])
+	})
+	if len(threads) > maxThreads {
+		threads, truncated = threads[:maxThreads], true
+	}
+	return threads, truncated, nil
+}
+
+// スレッドに startID 以上 endID 未満のメッセージがありうるか
+// スレッドの ID は作成日時、LastMessageID は最後のメッセージの日時を表す
+func threadInWindow(th *discordgo.Channel, startID, endID int64) bool {
+	if snowflakeOf(th) >= endID {
+		return false
+	}
+	if th.LastMessageID != "" {
+		if last, err := strconv.ParseInt(th.LastMessageID, 10, 64); err == nil && last < startID {
+			return false
+		}
+	}
+	return true
+}
+
+func snowflakeOf(ch *discordgo.Channel) int64 {
+	id, _ := strconv.ParseInt(ch.ID, 10, 64)
+	return id
+}
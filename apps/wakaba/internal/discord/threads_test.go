@@ -0,0 +1,117 @@
+package discord
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newThread(name, parentID string, created time.Time, archivedAt *time.Time, lastMessage time.Time) *discordgo.Channel {
+	th := &discordgo.Channel{
+		ID:             strconv.FormatInt(snowflakeFromTime(created), 10),
+		Name:           name,
+		ParentID:       parentID,
+		Type:           discordgo.ChannelTypeGuildPublicThread,
+		LastMessageID:  strconv.FormatInt(snowflakeFromTime(lastMessage), 10),
+		ThreadMetadata: &discordgo.ThreadMetadata{},
+	}
+	if archivedAt != nil {
+		th.ThreadMetadata.Archived = true
+		th.ThreadMetadata.ArchiveTimestamp = *archivedAt
+	}
+	return th
+}
+
+func TestFetchLinksIncludeThreads(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 999999999, jst)
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, jst) }
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	active := newThread("active", "channel", at(17, 1), nil, at(17, 2))
+	archived := newThread("archived", "channel", at(16, 20), ptr(at(17, 5)), at(17, 3))
+	private := newThread("private", "channel", at(17, 6), nil, at(17, 7))
+	private.Type = discordgo.ChannelTypeGuildPrivateThread
+	threads := []*discordgo.Channel{
+		active,
+		archived,
+		// start より前にアーカイブされたスレッドでアーカイブ済みの一覧の取得を打ち切る
+		newThread("old", "channel", at(14, 1), ptr(at(15, 1)), at(15, 1)),
+		// end より後に作成されたスレッド
+		newThread("future", "channel", at(18, 1), nil, at(18, 1)),
+		// ほかのチャンネルのスレッド
+		newThread("other", "other-channel", at(17, 1), nil, at(17, 1)),
+		// start より前に最後のメッセージがあるスレッド
+		newThread("quiet", "channel", at(10, 1), nil, at(10, 2)),
+		// アクティブなプライベートスレッド
+		private,
+	}
+	threadMessages := map[string][]*discordgo.Message{
+		active.ID:   generateMessages(at(17, 1), at(17, 3), time.Hour),
+		archived.ID: generateMessages(at(16, 21), at(17, 4), 6*time.Hour),
+		private.ID:  generateMessages(at(17, 6), at(17, 7), time.Hour),
+	}
+
+	t.Run("text channel", func(t *testing.T) {
+		fake := &fakeDiscord{
+			messages:       generateMessages(at(17, 0), at(17, 1), time.Hour),
+			channel:        &discordgo.Channel{ID: "channel", GuildID: "guild", Type: discordgo.ChannelTypeGuildText},
+			threads:        threads,
+			threadMessages: threadMessages,
+		}
+		s := newFakeSession(t, fake)
+
+		result, err := FetchLinks(s, "channel", start, end, "bot", &FetchOptions{IncludeThreads: true})
+		if err != nil {
+			t.Fatalf("FetchLinks() error = %v", err)
+		}
+
+		// 親チャンネル、スレッドの作成順にまとめる
+		wantThreads := []string{"", "archived", "active", "active"}
+		if len(result.CapturedLinks) != len(wantThreads) {
+			t.Fatalf("len(CapturedLinks) = %d, want %d: %+v", len(result.CapturedLinks), len(wantThreads), result.CapturedLinks)
+		}
+		for i, want := range wantThreads {
+			if got := result.CapturedLinks[i].ThreadName; got != want {
+				t.Errorf("CapturedLinks[%d].ThreadName = %q, want %q", i, got, want)
+			}
+		}
+		if got := result.CapturedLinks[1].ChannelID; got != archived.ID {
+			t.Errorf("CapturedLinks[1].ChannelID = %s, want thread ID %s", got, archived.ID)
+		}
+		if result.ThreadCount != 2 || result.ThreadsTruncated {
+			t.Errorf("ThreadCount = %d, ThreadsTruncated = %v, want 2, false", result.ThreadCount, result.ThreadsTruncated)
+		}
+		if result.MessageCount != 4 {
+			t.Errorf("MessageCount = %d, want 4", result.MessageCount)
+		}
+		// channel, active threads, archived threads, 親チャンネルと 2 スレッドのメッセージ
+		if got := fake.calls.Load(); got != 6 {
+			t.Errorf("API calls = %d, want 6", got)
+		}
+	})
+
+	t.Run("forum channel", func(t *testing.T) {
+		fake := &fakeDiscord{
+			channel:        &discordgo.Channel{ID: "channel", GuildID: "guild", Type: discordgo.ChannelTypeGuildForum},
+			threads:        threads,
+			threadMessages: threadMessages,
+		}
+		s := newFakeSession(t, fake)
+
+		result, err := FetchLinks(s, "channel", start, end, "bot", &FetchOptions{IncludeThreads: true})
+		if err != nil {
+			t.Fatalf("FetchLinks() error = %v", err)
+		}
+		if len(result.CapturedLinks) != 3 || result.CapturedLinks[0].ThreadName != "archived" {
+			t.Errorf("CapturedLinks = %+v, want posts only", result.CapturedLinks)
+		}
+		// フォーラム自体のメッセージは取得しない
+		if got := fake.calls.Load(); got != 5 {
+			t.Errorf("API calls = %d, want 5", got)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/repository"
 	"github.com/yotu/wakaba/internal/util"
 )
 
@@ -33,88 +35,412 @@ func ProcessSummarize(s *discordgo.Session, req *WorkerRequest) error {
 		json.Unmarshal(argBytes, &args)
 	}
 
-	// 日付引数をパース
-	now := time.Now()
-	start, end, err := util.ParseDateInput(args.DateArg, now)
+	if !isValidFormat(args.Format) {
+		return sendError(s, req, fmt.Sprintf("format の指定が正しくありません: %s", args.Format))
+	}
+
+	if !isValidGroupBy(args.GroupBy) {
+		return sendError(s, req, fmt.Sprintf("group_by の指定が正しくありません: %s", args.GroupBy))
+	}
+	if !isValidSort(args.Sort) {
+		return sendError(s, req, fmt.Sprintf("sort の指定が正しくありません: %s", args.Sort))
+	}
+
+	if args.Top < 0 || args.Top > MaxTopLinks {
+		return sendError(s, req, fmt.Sprintf("top は 1〜%d で指定してください", MaxTopLinks))
+	}
+	weights, err := parseScoreWeights(args.Score)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("score の指定が正しくありません: %v", err))
+	}
+
+	sources, err := discord.ParseLinkSources(args.Sources)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("sources の指定が正しくありません: %v", err))
+	}
+
+	scope := discord.Scope(args.Scope)
+	switch scope {
+	case "", discord.ScopeChannel:
+	case discord.ScopeCategory, discord.ScopeGuild:
+		if req.GuildID == "" {
+			return sendError(s, req, "scope:category と scope:guild はサーバー内でのみ使えます")
+		}
+	default:
+		return sendError(s, req, fmt.Sprintf("scope の指定が正しくありません: %s", args.Scope))
+	}
+
+	// タイムゾーンを決定し、日付引数をパース
+	settingsRepo, err := repository.NewSettingsRepository(context.Background())
+	if err != nil {
+		log.Printf("Settings repository init failed: %v", err)
+	}
+	loc := resolveLocation(context.Background(), settingsRepo, req)
+	now := time.Now().In(loc)
+	start, end, err := parsePeriod(&args, now)
 	if err != nil {
 		return sendError(s, req, fmt.Sprintf("[V2] 日付の形式が正しくありません: %v", err))
 	}
 
-	// 該当する日付のメッセージを取得
-	result, err := discord.FetchLinks(s, req.ChannelID, start, end, req.ApplicationID)
+	// 該当する期間のメッセージを取得
+	// キーワードの判定と with_title で、取得したタイトルと制限時間を共有する
+	metadata := newMetadataFetcher(context.Background())
+	filter := buildLinkFilter(&args, metadata)
+	result, err := discord.FetchScopeLinks(s, req.GuildID, req.ChannelID, scope, start, end, req.ApplicationID, req.UserID, &discord.FetchOptions{
+		Sources:        sources,
+		IncludeThreads: args.IncludeThreads,
+		Filter:         filter,
+	})
 	if err != nil {
 		return sendError(s, req, fmt.Sprintf("メッセージの取得に失敗しました: %v", err))
 	}
 
 	if len(result.CapturedLinks) == 0 {
-		return sendFollowup(s, req, fmt.Sprintf("%s のリンクは見つかりませんでした。(検索数: %d件)", start.Format("2006/01/02"), result.MessageCount))
+		// 定期投稿では、リンクがなかった日は何も投稿しない
+		if isScheduled(req) {
+			log.Printf("No links for digest %s", req.InteractionID)
+			return nil
+		}
+		return sendFollowup(s, req, fmt.Sprintf("%s のリンクは見つかりませんでした。(検索数: %d件)%s%s", formatPeriod(start, end), result.MessageCount, filterNote(filter, result), scopeNote(result)))
 	}
 
-	countHeader := fmt.Sprintf("count: %d\n", len(result.CapturedLinks))
-	var sb strings.Builder
-	sb.WriteString(countHeader)
-	sb.WriteString("```\n")
+	// dedupe = True の場合は同じリンクを 1 つにまとめる
+	links := result.CapturedLinks
+	countLabel := fmt.Sprintf("count: %d", len(links))
+	if args.Dedupe || args.Top > 0 {
+		links = discord.DedupeLinks(links)
+		countLabel = fmt.Sprintf("count: %d (重複を除く前: %d)", len(links), len(result.CapturedLinks))
+	}
+
+	// top = N の場合はスコアの高い N 件だけを表示する (同じリンクはまとめて共有回数もスコアに含める)
+	if args.Top > 0 {
+		ranked := make([]discord.CapturedLink, 0, args.Top)
+		for _, i := range rankLinks(links, weights, args.Top) {
+			ranked = append(ranked, links[i])
+		}
+		countLabel = fmt.Sprintf("上位 %d 件 / %d 件", len(ranked), len(links))
+		links = ranked
+	}
 
 	// with_title = True の場合は url のタイトルを取得して表示する
+	var previews []linkPreview
+	pending := 0
 	if args.WithTitle {
-		type titleResult struct {
-			index int
-			title string
-			url   string
+		previews = metadata.FetchAll(context.Background(), links)
+		for _, p := range previews {
+			if p.Pending {
+				pending++
+			}
 		}
-		ch := make(chan titleResult, len(result.CapturedLinks))
+	}
 
-		for i, u := range result.CapturedLinks {
-			go func(i int, u string) {
-				t, err := util.FetchPageTitle(u)
-				if err != nil {
-					t = "(no title)"
-				}
-				ch <- titleResult{index: i, title: t, url: u}
-			}(i, u)
+	blocks := buildSummaryBlocks(links, previews, start, end, summaryOptions{
+		GuildID:     req.GuildID,
+		HideAuthors: args.HideAuthors,
+		GroupBy:     args.GroupBy,
+		Sort:        args.Sort,
+		Top:         args.Top,
+		Weights:     weights,
+	})
+
+	summary := &repository.Summary{
+		ID:     req.InteractionID,
+		Title:  fmt.Sprintf("%s のリンク", formatPeriod(start, end)),
+		Footer: fmt.Sprintf("%s ・ %s%s", countLabel, loc, filterNote(filter, result)),
+		Pages:  paginateSummary(blocks, SummaryPageChars, SummaryPageLines),
+	}
+	if scope == discord.ScopeCategory || scope == discord.ScopeGuild {
+		summary.Footer += fmt.Sprintf(" ・ チャンネル %d 件", result.ChannelCount)
+		if result.ChannelsTruncated {
+			summary.Footer += " (上限に達したため一部のみ)"
 		}
+		summary.Footer += scopeNote(result)
+	}
+	if args.IncludeThreads {
+		summary.Footer += fmt.Sprintf(" ・ スレッド %d 件", result.ThreadCount)
+		if result.ThreadsTruncated {
+			summary.Footer += " (上限に達したため一部のみ)"
+		}
+	}
+	if pending > 0 {
+		summary.Footer += fmt.Sprintf(" ・ %d 件のタイトルは時間内に取得できませんでした", pending)
+	}
+
+	// ページ送りできるように結果を保存する
+	if len(summary.Pages) > 1 {
+		summaryRepo, err := repository.NewSummaryRepository(context.Background())
+		if err == nil {
+			err = summaryRepo.SaveSummary(context.Background(), summary)
+		}
+		if err != nil {
+			// 保存できなくても 1 ページ目は表示する
+			log.Printf("Failed to save summary: %v", err)
+			summary.Footer += " ・ ページ送りは利用できません"
+			summary.Pages = summary.Pages[:1]
+		}
+	}
+
+	// format が指定された場合はファイルを添付する
+	rows := buildExportRows(links, previews, req.GuildID, loc)
+	baseName := "links-" + start.Format("20060102")
+	if end.Format("20060102") != start.Format("20060102") {
+		baseName += "-" + end.Format("20060102")
+	}
+	file, err := renderExport(args.Format, summary.Title, baseName, rows)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("ファイルの作成に失敗しました: %v", err))
+	}
+
+	embed, components := renderSummaryPage(summary, 0)
+	embeds := []*discordgo.MessageEmbed{embed}
+	edit := &discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	}
+	if file != nil {
+		edit.Files = []*discordgo.File{file}
+	}
+	return editOriginal(s, req, edit)
+}
+
+// まとめの表示方法
+type summaryOptions struct {
+	GuildID     string // ジャンプリンクに使うサーバーの ID (DM の場合は空)
+	HideAuthors bool   // 投稿者を表示しない
+	GroupBy     string // group_by 引数 (GroupByNone など)
+	Sort        string // sort 引数 (SortPosted など)
+	Top         int    // top 引数。0 より大きい場合はスコアの高い順に順位をつけて表示する
+	Weights     scoreWeights
+
+	// buildSummaryBlocks が対象期間から設定する
+	Location *time.Location
+	MultiDay bool
+}
+
+// リンクを表示用のブロックに変換する
+// 1 リンクを "HH:MM @user タイトル — URL" の 1 行で表示し、時刻は投稿したメッセージへのリンクにする
+// top を指定した場合は順位をつけ、group_by を指定した場合は見出しごとにまとめる
+// 指定しない場合は、複数のチャンネルを対象にした場合はチャンネルごと、スレッドのリンクはスレッドごと、
+// 複数日にまたがる場合は日付ごとに見出しをつける (日付の見出しは投稿順に並べる場合のみ)
+func buildSummaryBlocks(links []discord.CapturedLink, previews []linkPreview, start, end time.Time, opts summaryOptions) []string {
+	opts.Location = start.Location()
+	opts.MultiDay = start.Format("20060102") != end.Format("20060102")
+	ranked := opts.Top > 0
+	grouped := !ranked && opts.GroupBy != "" && opts.GroupBy != GroupByNone
+	dayHeaders := opts.MultiDay && !ranked && !grouped && (opts.Sort == "" || opts.Sort == SortPosted)
+
+	// 日付の見出しがない場合は、時刻に日付をつける
+	timeFormat := "15:04"
+	if opts.MultiDay && !dayHeaders {
+		timeFormat = "01/02 15:04"
+	}
+
+	var blocks []string
+	for _, group := range arrangeLinks(links, previews, opts) {
+		var currentParent, currentChannel, currentDay string
+		for n, i := range group.Indexes {
+			link := links[i]
+			var block string
+			if grouped && n == 0 {
+				block = fmt.Sprintf("__**%s**__ (%d)\n", escapeMarkdown(group.Key), len(group.Indexes))
+			}
+			if ranked {
+				block = fmt.Sprintf("**%d.** ", n+1)
+			}
+			if !ranked && !grouped && link.ChannelName != currentParent {
+				block = "__**#" + escapeMarkdown(link.ChannelName) + "**__\n"
+				currentParent, currentChannel, currentDay = link.ChannelName, "", ""
+			}
+			if !ranked && !grouped && link.ChannelID != currentChannel {
+				if link.ThreadName != "" {
+					block += "🧵 __" + escapeMarkdown(link.ThreadName) + "__\n"
+				}
+				currentChannel, currentDay = link.ChannelID, ""
+			}
+			if dayHeaders {
+				day := link.PostedAt.In(opts.Location).Format("2006/01/02 (Mon)")
+				if day != currentDay {
+					block += "**" + day + "**\n"
+					currentDay = day
+				}
+			}
+
+			block += fmt.Sprintf("[%s](%s) ", link.PostedAt.In(opts.Location).Format(timeFormat), link.JumpURL(opts.GuildID))
+			if !opts.HideAuthors && link.AuthorName != "" {
+				block += "@" + escapeMarkdown(link.AuthorName) + " "
+			}
+
+			// with_title = True の場合はタイトル・サイト名・説明を、そうでなければマスクリンクの表示テキストをつける
+			var preview *linkPreview
+			if previews != nil {
+				preview = &previews[i]
+			}
+			title, desc := renderPreview(preview, link.Label)
+			if title != "" {
+				block += title + " — "
+			}
+			block += link.URL
 
-		results := make([]titleResult, len(result.CapturedLinks))
-		for i := 0; i < len(result.CapturedLinks); i++ {
-			r := <-ch
-			results[r.index] = r
+			// 順位をつける場合はリアクション・返信・共有の数を、
+			// そうでなければ同じリンクが複数回共有されている場合は回数と共有したユーザーを表示する
+			if ranked {
+				block += engagementLabel(link)
+			} else if n := link.ShareCount(); n > 1 {
+				if opts.HideAuthors {
+					block += fmt.Sprintf(" (×%d)", n)
+				} else {
+					block += fmt.Sprintf(" (×%d: %s)", n, escapeMarkdown(strings.Join(link.Sharers(), ", ")))
+				}
+			}
+			if !ranked && opts.Sort == SortReactions && link.TotalReactions() > 0 {
+				block += fmt.Sprintf(" ・ リアクション %d", link.TotalReactions())
+			}
+			if desc != "" {
+				block += "\n> " + desc
+			}
+
+			blocks = append(blocks, block)
 		}
+	}
+	return blocks
+}
 
-		for _, r := range results {
-			if r.title != "" {
-				sb.WriteString(r.title + "\n")
+// user, domain, exclude_domain, keyword 引数から抽出するリンクの条件を作る
+// キーワードがメッセージにない場合は、リンク先のタイトルを fetcher で取得して判定する
+// fetcher はすべてのチャンネルで共有するので、制限時間とホストごとの並列数はコマンド全体で守られる
+func buildLinkFilter(args *SummarizeArgs, fetcher *metadataFetcher) *discord.LinkFilter {
+	filter := &discord.LinkFilter{
+		AuthorID:       args.User,
+		IncludeDomains: discord.ParseDomainList(args.Domain),
+		ExcludeDomains: discord.ParseDomainList(args.ExcludeDomain),
+		Keyword:        strings.TrimSpace(args.Keyword),
+	}
+	if !filter.Active() {
+		return nil
+	}
+	if filter.Keyword != "" {
+		filter.Titles = func(links []discord.CapturedLink) []string {
+			titles := make([]string, len(links))
+			for i, p := range fetcher.FetchAll(context.Background(), links) {
+				if p.Meta != nil {
+					titles[i] = p.Meta.DisplayTitle()
+				}
 			}
-			sb.WriteString(r.url + "\n\n")
+			return titles
 		}
+	}
+	return filter
+}
+
+// 条件を指定した場合に、検索したメッセージのうち一致したものの数を返す
+func filterNote(filter *discord.LinkFilter, result *discord.FetchResult) string {
+	if !filter.Active() {
+		return ""
+	}
+	return fmt.Sprintf(" ・ 条件に一致: %d / %d メッセージ", result.MatchedMessageCount, result.MessageCount)
+}
+
+// 権限がないためスキップしたチャンネルの注記を返す
+func scopeNote(result *discord.FetchResult) string {
+	if len(result.SkippedChannels) == 0 {
+		return ""
+	}
+	names := make([]string, len(result.SkippedChannels))
+	for i, name := range result.SkippedChannels {
+		names[i] = "#" + name
+	}
+	return fmt.Sprintf(" ・ 権限がないため %d チャンネルをスキップしました: %s", len(names), truncateRunes(strings.Join(names, ", "), 300))
+}
 
-		// そうでない場合はurlのみ表示
-	} else {
-		sb.WriteString(strings.Join(result.CapturedLinks, "\n"))
-		sb.WriteString("\n")
+// date 引数、または from/to 引数から対象期間を決定する
+func parsePeriod(args *SummarizeArgs, now time.Time) (time.Time, time.Time, error) {
+	if args.DateArg != "" {
+		return util.ParseDateInput(args.DateArg, now)
+	}
+	if args.From == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("date または from を指定してください")
 	}
+	return util.ParseDateRange(args.From, args.To, now)
+}
 
-	sb.WriteString("```")
-	content := sb.String()
+// 期間を表示用の文字列にする（1 日だけの場合は日付のみ）
+func formatPeriod(start, end time.Time) string {
+	if start.Format("20060102") == end.Format("20060102") {
+		return start.Format("2006/01/02")
+	}
+	return start.Format("2006/01/02") + "〜" + end.Format("2006/01/02")
+}
 
-	// 2000文字を超えた場合は省略
-	if len(content) > 2000 {
-		content = content[:1900] + "\n...(略)\n```"
+// メタデータを "**タイトル** ｜ サイト名" と説明に整形する
+// メタデータがない場合は label (マスクリンクの表示テキストなど) をタイトルにする
+func renderPreview(preview *linkPreview, label string) (title, desc string) {
+	var meta *util.PageMetadata
+	if preview != nil {
+		meta = preview.Meta
+	}
+	if meta != nil {
+		title = meta.DisplayTitle()
+	}
+	if title == "" {
+		title = label
+	}
+	if title == "" {
+		if preview != nil && preview.Pending {
+			return "*(タイトルを時間内に取得できませんでした)*", ""
+		}
+		return "", ""
 	}
 
-	return sendFollowup(s, req, content)
+	title = "**" + escapeMarkdown(truncateRunes(title, 200)) + "**"
+	if meta != nil && meta.OGSiteName != "" && meta.OGSiteName != meta.DisplayTitle() {
+		title += " ｜ " + escapeMarkdown(truncateRunes(meta.OGSiteName, 50))
+	}
+	if meta != nil && meta.OGDescription != "" {
+		desc = escapeMarkdown(truncateRunes(strings.Join(strings.Fields(meta.OGDescription), " "), 100))
+	}
+	return title, desc
 }
 
 func sendError(s *discordgo.Session, req *WorkerRequest, msg string) error {
+	// 定期投稿ではエラーを投稿先のチャンネルに表示せず、ログに残す
+	if isScheduled(req) {
+		log.Printf("Digest %s failed: %s", req.InteractionID, msg)
+		return nil
+	}
 	return sendFollowup(s, req, "エラー: "+msg)
 }
 
+// 定期投稿のように、応答するインタラクションがないリクエストか
+func isScheduled(req *WorkerRequest) bool {
+	return req.InteractionToken == ""
+}
+
 // 処理結果を表示する（元のメッセージを更新する形で送信する）
 func sendFollowup(s *discordgo.Session, req *WorkerRequest, content string) error {
-	// WebhookMessageEdit は指定したメッセージを更新する
-	// messageId = @original は slash command に対する最初のレスポンス（ping-pong 時に表示される「考え中...」）を指す
-	_, err := s.WebhookMessageEdit(req.ApplicationID, req.InteractionToken, "@original", &discordgo.WebhookEdit{
+	return editOriginal(s, req, &discordgo.WebhookEdit{
 		Content: &content,
 	})
+}
+
+// 処理結果を Embed とボタンで表示する
+func sendFollowupEmbed(s *discordgo.Session, req *WorkerRequest, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) error {
+	embeds := []*discordgo.MessageEmbed{embed}
+	return editOriginal(s, req, &discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	})
+}
+
+func editOriginal(s *discordgo.Session, req *WorkerRequest, edit *discordgo.WebhookEdit) error {
+	// 定期投稿の場合は応答するインタラクションがないので、Bot として投稿先のチャンネルに送信する
+	if isScheduled(req) {
+		return sendChannelMessage(s, req.TargetChannelID, edit)
+	}
+
+	// WebhookMessageEdit は指定したメッセージを更新する
+	// messageId = @original は slash command に対する最初のレスポンス（ping-pong 時に表示される「考え中...」）を指す
+	// ボタン押下時は、ボタンが付いているメッセージを指す
+	_, err := s.WebhookMessageEdit(req.ApplicationID, req.InteractionToken, "@original", edit)
 
 	if err != nil {
 		log.Printf("Failed to send followup: %v", err)
@@ -122,3 +448,23 @@ func sendFollowup(s *discordgo.Session, req *WorkerRequest, content string) erro
 	}
 	return nil
 }
+
+// WebhookEdit と同じ内容をチャンネルに新しいメッセージとして送信する
+func sendChannelMessage(s *discordgo.Session, channelID string, edit *discordgo.WebhookEdit) error {
+	msg := &discordgo.MessageSend{Files: edit.Files}
+	if edit.Content != nil {
+		msg.Content = *edit.Content
+	}
+	if edit.Embeds != nil {
+		msg.Embeds = *edit.Embeds
+	}
+	if edit.Components != nil {
+		msg.Components = *edit.Components
+	}
+
+	if _, err := s.ChannelMessageSendComplex(channelID, msg); err != nil {
+		log.Printf("Failed to send message to %s: %v", channelID, err)
+		return err
+	}
+	return nil
+}
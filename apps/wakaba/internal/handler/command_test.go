@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+func TestBuildSummaryBlocks(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 0, jst)
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, jst) }
+
+	links := []discord.CapturedLink{
+		{URL: "https://example.com/1", PostedAt: at(16, 9), ChannelID: "channel", MessageID: "1", AuthorName: "alice"},
+		{URL: "https://example.com/2", PostedAt: at(17, 9), ChannelID: "channel", MessageID: "2", AuthorName: "bob", Label: "docs"},
+		{URL: "https://example.com/3", PostedAt: at(17, 10), ChannelID: "thread-a", MessageID: "3", AuthorName: "alice", ThreadName: "設計_相談"},
+		{URL: "https://example.com/4", PostedAt: at(17, 11), ChannelID: "thread-a", MessageID: "4", AuthorName: "carol_c"},
+		{URL: "https://example.com/5", PostedAt: at(16, 12), ChannelID: "thread-b", MessageID: "5", AuthorName: "bob", ThreadName: "雑談"},
+	}
+
+	want := []string{
+		"**2026/10/16 (Fri)**\n[09:00](https://discord.com/channels/guild/channel/1) @alice https://example.com/1",
+		"**2026/10/17 (Sat)**\n[09:00](https://discord.com/channels/guild/channel/2) @bob **docs** — https://example.com/2",
+		"🧵 __設計\\_相談__\n**2026/10/17 (Sat)**\n[10:00](https://discord.com/channels/guild/thread-a/3) @alice https://example.com/3",
+		"[11:00](https://discord.com/channels/guild/thread-a/4) @carol\\_c https://example.com/4",
+		"🧵 __雑談__\n**2026/10/16 (Fri)**\n[12:00](https://discord.com/channels/guild/thread-b/5) @bob https://example.com/5",
+	}
+	if got := buildSummaryBlocks(links, nil, start, end, summaryOptions{GuildID: "guild"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildSummaryBlocks() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildSummaryBlocksChannels(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	day := time.Date(2026, 10, 17, 0, 0, 0, 0, jst)
+
+	links := []discord.CapturedLink{
+		{URL: "https://example.com/1", PostedAt: day, ChannelID: "a", MessageID: "1", ChannelName: "general"},
+		{URL: "https://example.com/2", PostedAt: day, ChannelID: "a-thread", MessageID: "2", ChannelName: "general", ThreadName: "相談"},
+		{URL: "https://example.com/3", PostedAt: day, ChannelID: "b", MessageID: "3", ChannelName: "random"},
+	}
+
+	want := []string{
+		"__**#general**__\n[00:00](https://discord.com/channels/@me/a/1) https://example.com/1",
+		"🧵 __相談__\n[00:00](https://discord.com/channels/@me/a-thread/2) https://example.com/2",
+		"__**#random**__\n[00:00](https://discord.com/channels/@me/b/3) https://example.com/3",
+	}
+	if got := buildSummaryBlocks(links, nil, day, day.Add(time.Hour), summaryOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildSummaryBlocks() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildSummaryBlocksPreviews(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	day := time.Date(2026, 10, 17, 21, 5, 0, 0, jst)
+
+	shared := discord.CapturedLink{URL: "https://example.com/a", PostedAt: day, ChannelID: "c", MessageID: "1", AuthorID: "1", AuthorName: "alice"}
+	shared.Duplicates = []discord.CapturedLink{{AuthorID: "2", AuthorName: "bob"}}
+	links := []discord.CapturedLink{
+		shared,
+		{URL: "https://example.com/b", PostedAt: day, ChannelID: "c", MessageID: "2", AuthorName: "bob"},
+		{URL: "https://example.com/c", PostedAt: day, ChannelID: "c", MessageID: "3", AuthorName: "bob", Label: "label"},
+	}
+	previews := []linkPreview{
+		{Meta: &util.PageMetadata{OGTitle: "Title", OGSiteName: "Example", OGDescription: "line 1\n  line 2"}},
+		{Pending: true},
+		{},
+	}
+
+	t.Run("with authors", func(t *testing.T) {
+		want := []string{
+			"[21:05](https://discord.com/channels/g/c/1) @alice **Title** ｜ Example — https://example.com/a (×2: alice, bob)\n> line 1 line 2",
+			"[21:05](https://discord.com/channels/g/c/2) @bob *(タイトルを時間内に取得できませんでした)* — https://example.com/b",
+			"[21:05](https://discord.com/channels/g/c/3) @bob **label** — https://example.com/c",
+		}
+		if got := buildSummaryBlocks(links, previews, day, day, summaryOptions{GuildID: "g"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("buildSummaryBlocks() =\n%q\nwant\n%q", got, want)
+		}
+	})
+
+	t.Run("hide authors", func(t *testing.T) {
+		got := buildSummaryBlocks(links[:1], previews[:1], day, day, summaryOptions{GuildID: "g", HideAuthors: true})
+		want := "[21:05](https://discord.com/channels/g/c/1) **Title** ｜ Example — https://example.com/a (×2)\n> line 1 line 2"
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("buildSummaryBlocks() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestBuildSummaryBlocksGrouped(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, jst)
+	end := time.Date(2026, 10, 17, 23, 59, 59, 0, jst)
+
+	links := []discord.CapturedLink{
+		{URL: "https://example.com/1", PostedAt: time.Date(2026, 10, 16, 9, 0, 0, 0, jst), ChannelID: "c", MessageID: "1", ReactionCount: 2},
+		{URL: "https://go.dev/", PostedAt: time.Date(2026, 10, 17, 9, 0, 0, 0, jst), ChannelID: "c", MessageID: "2"},
+	}
+
+	// 日付の見出しの代わりに時刻に日付をつける
+	want := []string{
+		"__**example.com**__ (1)\n[10/16 09:00](https://discord.com/channels/g/c/1) https://example.com/1 ・ リアクション 2",
+		"__**go.dev**__ (1)\n[10/17 09:00](https://discord.com/channels/g/c/2) https://go.dev/",
+	}
+	got := buildSummaryBlocks(links, nil, start, end, summaryOptions{GuildID: "g", GroupBy: GroupByDomain, Sort: SortReactions})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildSummaryBlocks() =\n%q\nwant\n%q", got, want)
+	}
+}
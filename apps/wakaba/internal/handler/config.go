@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/repository"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+func ProcessConfig(s *discordgo.Session, req *WorkerRequest) error {
+	repo, err := repository.NewSettingsRepository(context.Background())
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Repository init failed: %v", err))
+	}
+
+	var args ConfigArgs
+	if argBytes, err := json.Marshal(req.CommandArgs); err == nil {
+		json.Unmarshal(argBytes, &args)
+	}
+
+	switch args.SubCommand {
+	case "timezone":
+		return handleTimezone(s, req, repo, &args)
+	default:
+		return sendError(s, req, "Unknown subcommand")
+	}
+}
+
+func handleTimezone(s *discordgo.Session, req *WorkerRequest, repo *repository.SettingsRepository, args *ConfigArgs) error {
+	// zone が指定されていない場合は現在の設定を表示する
+	if args.Zone == "" {
+		loc := resolveLocation(context.Background(), repo, req)
+		return sendFollowup(s, req, fmt.Sprintf("現在のタイムゾーン: %s", loc))
+	}
+
+	loc, err := time.LoadLocation(args.Zone)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("タイムゾーン %q が見つかりません (例: Asia/Tokyo, America/New_York)", args.Zone))
+	}
+
+	var id, target string
+	switch args.Scope {
+	case "", "guild":
+		if req.GuildID == "" {
+			return sendError(s, req, "サーバーのタイムゾーンはサーバー内でのみ設定できます")
+		}
+		if req.MemberPermissions&discordgo.PermissionManageGuild == 0 {
+			return sendError(s, req, "サーバーのタイムゾーンを変更するには「サーバー管理」権限が必要です")
+		}
+		id, target = repository.GuildSettingsID(req.GuildID), "サーバー"
+	case "user":
+		id, target = repository.UserSettingsID(req.UserID), "あなた"
+	default:
+		return sendError(s, req, fmt.Sprintf("Unknown scope: %s", args.Scope))
+	}
+
+	settings, err := repo.GetSettings(context.Background(), id)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to get settings: %v", err))
+	}
+	settings.Timezone = loc.String()
+	if err := repo.SaveSettings(context.Background(), settings); err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to save settings: %v", err))
+	}
+
+	return sendFollowup(s, req, fmt.Sprintf("%sのタイムゾーンを %s に設定しました。", target, loc))
+}
+
+// リクエストしたユーザー、ギルドの順に設定を参照してタイムゾーンを決定する
+// どちらも未設定の場合や取得に失敗した場合は util.DefaultLocation を返す
+func resolveLocation(ctx context.Context, repo *repository.SettingsRepository, req *WorkerRequest) *time.Location {
+	if repo == nil {
+		return util.DefaultLocation
+	}
+
+	var ids []string
+	if req.UserID != "" {
+		ids = append(ids, repository.UserSettingsID(req.UserID))
+	}
+	if req.GuildID != "" {
+		ids = append(ids, repository.GuildSettingsID(req.GuildID))
+	}
+
+	for _, id := range ids {
+		settings, err := repo.GetSettings(ctx, id)
+		if err != nil {
+			log.Printf("Failed to get settings %s: %v", id, err)
+			continue
+		}
+		if settings.Timezone == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(settings.Timezone)
+		if err != nil {
+			log.Printf("Invalid timezone %q in settings %s: %v", settings.Timezone, id, err)
+			continue
+		}
+		return loc
+	}
+
+	return util.DefaultLocation
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/repository"
+)
+
+func ProcessDigest(s *discordgo.Session, req *WorkerRequest) error {
+	repo, err := repository.NewDigestRepository(context.Background())
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Repository init failed: %v", err))
+	}
+
+	var args DigestArgs
+	if argBytes, err := json.Marshal(req.CommandArgs); err == nil {
+		json.Unmarshal(argBytes, &args)
+	}
+
+	if req.GuildID == "" {
+		return sendError(s, req, "/digest はサーバー内でのみ使えます")
+	}
+
+	// チャンネルを省略した場合はコマンドを実行したチャンネル
+	if args.Channel == "" {
+		args.Channel = req.ChannelID
+	}
+	if args.Target == "" {
+		args.Target = req.ChannelID
+	}
+
+	switch args.SubCommand {
+	case "subscribe":
+		return handleDigestSubscribe(s, req, repo, &args)
+	case "unsubscribe":
+		return handleDigestUnsubscribe(s, req, repo, &args)
+	case "list":
+		return handleDigestList(s, req, repo)
+	default:
+		return sendError(s, req, "Unknown subcommand")
+	}
+}
+
+func handleDigestSubscribe(s *discordgo.Session, req *WorkerRequest, repo *repository.DigestRepository, args *DigestArgs) error {
+	if req.MemberPermissions&discordgo.PermissionManageGuild == 0 {
+		return sendError(s, req, "定期投稿を設定するには「サーバー管理」権限が必要です")
+	}
+
+	at, err := parseDigestTime(args.Time)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("time の指定が正しくありません: %s (例: 09:00)", args.Time))
+	}
+
+	permissions := func(channelID, userID string) (int64, error) {
+		return discord.ChannelPermissions(s, req.GuildID, channelID, userID)
+	}
+	if err := checkDigestPermissions(permissions, req, args); err != nil {
+		return sendError(s, req, err.Error())
+	}
+
+	sub := &repository.DigestSubscription{
+		ID:              repository.DigestSubscriptionID(args.Channel, args.Target),
+		GuildID:         req.GuildID,
+		ChannelID:       args.Channel,
+		TargetChannelID: args.Target,
+		Time:            at,
+		ApplicationID:   req.ApplicationID,
+		CreatedBy:       req.UserID,
+	}
+	// 設定した日にすでに時刻を過ぎている場合は、翌日から投稿する
+	settingsRepo, err := repository.NewSettingsRepository(context.Background())
+	if err != nil {
+		log.Printf("Settings repository init failed: %v", err)
+	}
+	loc := resolveLocation(context.Background(), settingsRepo, &WorkerRequest{GuildID: req.GuildID})
+	if date, due := digestDueDate(sub, time.Now(), loc); due {
+		sub.LastPostedDate = date
+	}
+
+	if err := repo.SaveSubscription(context.Background(), sub); err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to save subscription: %v", err))
+	}
+
+	return sendFollowup(s, req, fmt.Sprintf("毎日 %s (%s) に <#%s> の前日のリンクを <#%s> に投稿します。", at, loc, args.Channel, args.Target))
+}
+
+// 定期投稿の投稿先のチャンネルで Bot に必要な権限
+const digestPostPermissions = discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks
+
+// 設定するユーザーがまとめるチャンネルを読めること、Bot がまとめるチャンネルを読めて投稿先に投稿できることを確かめる
+// 読めないチャンネルのリンクを、他の人が見られるチャンネルに投稿させないようにする
+// permissions はユーザーのチャンネルでの権限を返す
+func checkDigestPermissions(permissions func(channelID, userID string) (int64, error), req *WorkerRequest, args *DigestArgs) error {
+	checks := []struct {
+		channelID, userID string
+		required          int64
+		message           string
+	}{
+		{args.Channel, req.UserID, discord.ReadPermissions, fmt.Sprintf("<#%s> のメッセージを読む権限がないため、定期投稿を設定できません", args.Channel)},
+		{args.Channel, req.ApplicationID, discord.ReadPermissions, fmt.Sprintf("Bot に <#%s> のメッセージを読む権限がありません", args.Channel)},
+		{args.Target, req.ApplicationID, digestPostPermissions, fmt.Sprintf("Bot に <#%s> へメッセージと埋め込みリンクを送信する権限がありません", args.Target)},
+	}
+	for _, c := range checks {
+		perms, err := permissions(c.channelID, c.userID)
+		if err != nil {
+			log.Printf("Failed to get permissions of %s in %s: %v", c.userID, c.channelID, err)
+			return fmt.Errorf("<#%s> の権限を確認できませんでした", c.channelID)
+		}
+		if perms&c.required != c.required {
+			return errors.New(c.message)
+		}
+	}
+	return nil
+}
+
+func handleDigestUnsubscribe(s *discordgo.Session, req *WorkerRequest, repo *repository.DigestRepository, args *DigestArgs) error {
+	if req.MemberPermissions&discordgo.PermissionManageGuild == 0 {
+		return sendError(s, req, "定期投稿を解除するには「サーバー管理」権限が必要です")
+	}
+
+	deleted, err := repo.DeleteSubscription(context.Background(), repository.DigestSubscriptionID(args.Channel, args.Target))
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to delete subscription: %v", err))
+	}
+	if !deleted {
+		return sendFollowup(s, req, fmt.Sprintf("<#%s> から <#%s> への定期投稿は設定されていません。", args.Channel, args.Target))
+	}
+	return sendFollowup(s, req, fmt.Sprintf("<#%s> から <#%s> への定期投稿を解除しました。", args.Channel, args.Target))
+}
+
+func handleDigestList(s *discordgo.Session, req *WorkerRequest, repo *repository.DigestRepository) error {
+	subs, err := repo.ListSubscriptions(context.Background())
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to list subscriptions: %v", err))
+	}
+
+	var lines []string
+	for _, sub := range subs {
+		if sub.GuildID != req.GuildID {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- 毎日 %s: <#%s> → <#%s>", sub.Time, sub.ChannelID, sub.TargetChannelID))
+	}
+	if len(lines) == 0 {
+		return sendFollowup(s, req, "定期投稿は設定されていません。")
+	}
+	return sendFollowup(s, req, "定期投稿の設定:\n"+strings.Join(lines, "\n"))
+}
+
+// EventBridge のスケジュールから定期的に呼ばれ、投稿時刻を過ぎた設定の前日のまとめを投稿する
+// まとめは設定ごとに非同期で実行し、通常の /summarize と同じ処理で作成する
+func ProcessScheduledDigests(ctx context.Context, now time.Time) error {
+	repo, err := repository.NewDigestRepository(ctx)
+	if err != nil {
+		return err
+	}
+	subs, err := repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	settingsRepo, err := repository.NewSettingsRepository(ctx)
+	if err != nil {
+		log.Printf("Settings repository init failed: %v", err)
+	}
+	locations := map[string]*time.Location{}
+
+	for i := range subs {
+		sub := &subs[i]
+		loc, ok := locations[sub.GuildID]
+		if !ok {
+			loc = resolveLocation(ctx, settingsRepo, &WorkerRequest{GuildID: sub.GuildID})
+			locations[sub.GuildID] = loc
+		}
+
+		date, due := digestDueDate(sub, now, loc)
+		if !due {
+			continue
+		}
+		claimed, err := repo.ClaimDate(ctx, sub.ID, date)
+		if err != nil {
+			log.Printf("Failed to claim digest %s for %s: %v", sub.ID, date, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := invokeSelfAsync(ctx, digestRequest(sub, now.In(loc))); err != nil {
+			log.Printf("Failed to start digest %s: %v", sub.ID, err)
+			// 予約を取り消し、次のスケジュールの実行で投稿し直す
+			if err := repo.ReleaseDate(ctx, sub.ID, date, sub.LastPostedDate); err != nil {
+				log.Printf("Failed to release digest %s for %s: %v", sub.ID, date, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 設定の投稿時刻を過ぎていて、その日にまだ投稿していない場合に、その日の日付と true を返す
+func digestDueDate(sub *repository.DigestSubscription, now time.Time, loc *time.Location) (string, bool) {
+	at, err := time.Parse("15:04", sub.Time)
+	if err != nil {
+		log.Printf("Invalid digest time %q in %s: %v", sub.Time, sub.ID, err)
+		return "", false
+	}
+	local := now.In(loc)
+	scheduled := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	date := local.Format("2006-01-02")
+	if local.Before(scheduled) || sub.LastPostedDate == date {
+		return date, false
+	}
+	return date, true
+}
+
+// 前日のまとめを作成するリクエストを返す
+// インタラクションがないので、結果は Bot のトークンで投稿先のチャンネルに送る
+func digestRequest(sub *repository.DigestSubscription, now time.Time) WorkerRequest {
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	return WorkerRequest{
+		Type: "digest",
+		// ページ送りのためのまとめの ID (ボタンの CustomID に含めるので ":" は使わない)
+		InteractionID:   fmt.Sprintf("digest-%s-%s-%s", sub.ChannelID, sub.TargetChannelID, strings.ReplaceAll(yesterday, "-", "")),
+		ChannelID:       sub.ChannelID,
+		TargetChannelID: sub.TargetChannelID,
+		ApplicationID:   sub.ApplicationID,
+		GuildID:         sub.GuildID,
+		CommandName:     "summarize",
+		CommandArgs:     map[string]any{"date": yesterday},
+	}
+}
+
+// 全角の数字とコロンを半角に揃える
+var digestTimeReplacer = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+	"５", "5", "６", "6", "７", "7", "８", "8", "９", "9", "：", ":",
+)
+
+// "9:00", "09:00", "0900" のような時刻を "09:00" に揃える
+func parseDigestTime(input string) (string, error) {
+	input = strings.TrimSpace(digestTimeReplacer.Replace(input))
+	for _, layout := range []string{"15:04", "1504"} {
+		if t, err := time.Parse(layout, input); err == nil {
+			return t.Format("15:04"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid time: %s", input)
+}
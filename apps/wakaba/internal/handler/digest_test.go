@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/repository"
+)
+
+func TestParseDigestTime(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "09:00", want: "09:00"},
+		{input: "9:05", want: "09:05"},
+		{input: " ２１：３０ ", want: "21:30"},
+		{input: "0730", want: "07:30"},
+		{input: "24:00", wantErr: true},
+		{input: "morning", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDigestTime(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDigestTime(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDigestTime(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDigestDueDate(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	sub := &repository.DigestSubscription{ID: "c:t", Time: "09:00"}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		lastDate string
+		wantDue  bool
+	}{
+		{name: "before time", now: time.Date(2026, 10, 17, 8, 59, 0, 0, jst)},
+		{name: "at time", now: time.Date(2026, 10, 17, 9, 0, 0, 0, jst), wantDue: true},
+		{name: "late", now: time.Date(2026, 10, 17, 23, 0, 0, 0, jst), lastDate: "2026-10-16", wantDue: true},
+		{name: "already posted", now: time.Date(2026, 10, 17, 9, 10, 0, 0, jst), lastDate: "2026-10-17"},
+		// UTC では前日でもサーバーのタイムゾーンで判定する
+		{name: "timezone", now: time.Date(2026, 10, 17, 0, 30, 0, 0, time.UTC), lastDate: "2026-10-16", wantDue: true},
+	}
+	for _, tt := range tests {
+		sub.LastPostedDate = tt.lastDate
+		date, due := digestDueDate(sub, tt.now, jst)
+		if due != tt.wantDue {
+			t.Errorf("%s: digestDueDate() due = %v, want %v", tt.name, due, tt.wantDue)
+		}
+		if date != "2026-10-17" {
+			t.Errorf("%s: digestDueDate() date = %q, want 2026-10-17", tt.name, date)
+		}
+	}
+}
+
+func TestDigestRequest(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	sub := &repository.DigestSubscription{GuildID: "g", ChannelID: "c", TargetChannelID: "t", ApplicationID: "app"}
+
+	got := digestRequest(sub, time.Date(2026, 10, 1, 9, 0, 0, 0, jst))
+	want := WorkerRequest{
+		Type:            "digest",
+		InteractionID:   "digest-c-t-20260930",
+		ChannelID:       "c",
+		TargetChannelID: "t",
+		ApplicationID:   "app",
+		GuildID:         "g",
+		CommandName:     "summarize",
+		CommandArgs:     map[string]any{"date": "2026-09-30"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("digestRequest() = %+v, want %+v", got, want)
+	}
+
+	// 前日の日付として解釈できること
+	var args SummarizeArgs
+	args.DateArg = got.CommandArgs["date"].(string)
+	start, end, err := parsePeriod(&args, time.Date(2026, 10, 1, 9, 0, 0, 0, jst))
+	if err != nil {
+		t.Fatalf("parsePeriod() error = %v", err)
+	}
+	if start.Format("2006/01/02") != "2026/09/30" || end.Format("2006/01/02") != "2026/09/30" {
+		t.Errorf("parsePeriod() = %v, %v, want 2026/09/30", start, end)
+	}
+}
+
+func TestCheckDigestPermissions(t *testing.T) {
+	req := &WorkerRequest{GuildID: "g", UserID: "user", ApplicationID: "bot"}
+	args := &DigestArgs{Channel: "private", Target: "public"}
+	post := int64(digestPostPermissions)
+
+	tests := []struct {
+		name  string
+		perms map[string]int64 // "<channel>/<user>" ごとの権限
+		want  string           // エラーに含まれる文字列 (空の場合はエラーなし)
+	}{
+		{
+			name:  "allowed",
+			perms: map[string]int64{"private/user": discord.ReadPermissions, "private/bot": discord.ReadPermissions, "public/bot": post},
+		},
+		{
+			// 読めないチャンネルのリンクを公開チャンネルに投稿させない
+			name:  "user cannot read channel",
+			perms: map[string]int64{"private/user": discordgo.PermissionViewChannel, "private/bot": discord.ReadPermissions, "public/bot": post},
+			want:  "読む権限がないため",
+		},
+		{
+			name:  "bot cannot read channel",
+			perms: map[string]int64{"private/user": discord.ReadPermissions, "public/bot": post},
+			want:  "Bot に <#private>",
+		},
+		{
+			name:  "bot cannot post to target",
+			perms: map[string]int64{"private/user": discord.ReadPermissions, "private/bot": discord.ReadPermissions, "public/bot": discordgo.PermissionViewChannel | discordgo.PermissionSendMessages},
+			want:  "Bot に <#public>",
+		},
+	}
+	for _, tt := range tests {
+		permissions := func(channelID, userID string) (int64, error) {
+			return tt.perms[channelID+"/"+userID], nil
+		}
+		err := checkDigestPermissions(permissions, req, args)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	failing := func(channelID, userID string) (int64, error) { return 0, errors.New("unknown channel") }
+	if err := checkDigestPermissions(failing, req, args); err == nil {
+		t.Error("checkDigestPermissions() should fail when permissions cannot be fetched")
+	}
+}
+
+func TestSendErrorScheduled(t *testing.T) {
+	// 定期投稿のエラーは投稿先のチャンネルに送らない
+	s, requests := newRecordingSession(t)
+	req := &WorkerRequest{Type: "digest", InteractionID: "digest-c-t-20261016", ChannelID: "c", TargetChannelID: "t"}
+	if err := sendError(s, req, "failed"); err != nil {
+		t.Fatalf("sendError() error = %v", err)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("requests = %+v, want none", *requests)
+	}
+
+	req.InteractionToken = "token"
+	req.ApplicationID = "app"
+	if err := sendError(s, req, "failed"); err != nil || len(*requests) != 1 {
+		t.Errorf("sendError(interaction) = %v, requests = %+v, want one edit", err, *requests)
+	}
+}
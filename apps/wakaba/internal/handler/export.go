@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/discord"
+)
+
+// /summarize の format 引数で指定できる出力形式
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+)
+
+// ファイルに書き出す 1 リンク分のデータ
+type exportRow struct {
+	URL      string `json:"url"`
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author"`
+	AuthorID string `json:"author_id"`
+	PostedAt string `json:"posted_at"`
+	JumpURL  string `json:"jump_url"`
+	Origin   string `json:"origin,omitempty"` // content, embeds, attachments, forwards, replies
+	Channel  string `json:"channel,omitempty"`
+	Thread   string `json:"thread,omitempty"`
+	// dedupe でまとめた場合の共有回数と共有したユーザー
+	ShareCount int      `json:"share_count"`
+	SharedBy   []string `json:"shared_by"`
+	Reactions  int      `json:"reactions"`
+}
+
+func isValidFormat(format string) bool {
+	switch format {
+	case "", FormatText, FormatMarkdown, FormatCSV, FormatJSON:
+		return true
+	}
+	return false
+}
+
+func buildExportRows(links []discord.CapturedLink, previews []linkPreview, guildID string, loc *time.Location) []exportRow {
+	rows := make([]exportRow, 0, len(links))
+	for i, link := range links {
+		row := exportRow{
+			URL:      link.URL,
+			Author:   link.AuthorName,
+			AuthorID: link.AuthorID,
+			PostedAt: link.PostedAt.In(loc).Format(time.RFC3339),
+			JumpURL:  link.JumpURL(guildID),
+			Origin:   string(link.Origin),
+			Channel:  link.ChannelName,
+			Thread:   link.ThreadName,
+
+			ShareCount: link.ShareCount(),
+			SharedBy:   link.Sharers(),
+			Reactions:  link.TotalReactions(),
+		}
+		if previews != nil && previews[i].Meta != nil {
+			row.Title = previews[i].Meta.DisplayTitle()
+		}
+		if row.Title == "" {
+			row.Title = link.Label
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Markdown のリンクテキストで意味を持つ文字をエスケープする
+var markdownLabel = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+
+// URL を Markdown のリンク先にする
+// 括弧を含む URL でもリンクが途切れないように <> で囲み、囲みの中で使えない文字はエンコードする
+func markdownDestination(u string) string {
+	return "<" + strings.NewReplacer("<", "%3C", ">", "%3E", " ", "%20").Replace(u) + ">"
+}
+
+// まとめ結果を指定された形式のファイルにする
+// text 形式の場合はファイルを作らず nil を返す
+func renderExport(format, title, baseName string, rows []exportRow) (*discordgo.File, error) {
+	var buf bytes.Buffer
+	var ext, contentType string
+
+	switch format {
+	case "", FormatText:
+		return nil, nil
+	case FormatMarkdown:
+		ext, contentType = "md", "text/markdown; charset=utf-8"
+		fmt.Fprintf(&buf, "# %s\n\n", title)
+		for _, r := range rows {
+			label := r.URL
+			if r.Title != "" {
+				label = r.Title
+			}
+			fmt.Fprintf(&buf, "- [%s](%s) — %s, %s ([message](%s))", markdownLabel.Replace(label), markdownDestination(r.URL), r.Author, r.PostedAt, r.JumpURL)
+			if r.ShareCount > 1 {
+				fmt.Fprintf(&buf, " ×%d (%s)", r.ShareCount, strings.Join(r.SharedBy, ", "))
+			}
+			buf.WriteString("\n")
+		}
+	case FormatCSV:
+		ext, contentType = "csv", "text/csv; charset=utf-8"
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"url", "title", "author", "author_id", "posted_at", "jump_url", "share_count", "shared_by", "origin", "channel", "thread", "reactions"})
+		for _, r := range rows {
+			w.Write([]string{r.URL, r.Title, r.Author, r.AuthorID, r.PostedAt, r.JumpURL, strconv.Itoa(r.ShareCount), strings.Join(r.SharedBy, ", "), r.Origin, r.Channel, r.Thread, strconv.Itoa(r.Reactions)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		ext, contentType = "json", "application/json"
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(rows); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	return &discordgo.File{
+		Name:        baseName + "." + ext,
+		ContentType: contentType,
+		Reader:      &buf,
+	}, nil
+}
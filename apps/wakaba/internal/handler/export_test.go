@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+func TestRenderExport(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	links := []discord.CapturedLink{
+		{
+			URL:        "https://example.com/a?x=1&y=2",
+			PostedAt:   time.Date(2026, 10, 17, 9, 30, 0, 0, jst),
+			MessageID:  "300",
+			ChannelID:  "200",
+			AuthorID:   "10",
+			AuthorName: "alice",
+		},
+		{
+			URL:        "https://example.org/b",
+			PostedAt:   time.Date(2026, 10, 17, 21, 0, 0, 0, jst),
+			MessageID:  "301",
+			ChannelID:  "200",
+			AuthorID:   "11",
+			AuthorName: "bob, jr.",
+			Origin:     discord.SourceEmbeds,
+		},
+	}
+	rows := buildExportRows(links, []linkPreview{{Meta: &util.PageMetadata{OGTitle: "Title [A]"}}, {}}, "100", jst)
+
+	t.Run("text has no file", func(t *testing.T) {
+		file, err := renderExport(FormatText, "title", "links", rows)
+		if err != nil || file != nil {
+			t.Errorf("renderExport(text) = %v, %v, want nil, nil", file, err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if _, err := renderExport("xml", "title", "links", rows); err == nil {
+			t.Error("renderExport(xml) error = nil, want error")
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		file, err := renderExport(FormatCSV, "title", "links", rows)
+		if err != nil {
+			t.Fatalf("renderExport(csv) error = %v", err)
+		}
+		if file.Name != "links.csv" {
+			t.Errorf("file.Name = %q, want links.csv", file.Name)
+		}
+		records, err := csv.NewReader(file.Reader).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid csv: %v", err)
+		}
+		if len(records) != 3 {
+			t.Fatalf("len(records) = %d, want 3", len(records))
+		}
+		want := []string{"https://example.org/b", "", "bob, jr.", "11", "2026-10-17T21:00:00+09:00", "https://discord.com/channels/100/200/301", "1", "bob, jr.", "embeds", "", "", "0"}
+		if strings.Join(records[2], "|") != strings.Join(want, "|") {
+			t.Errorf("records[2] = %q, want %q", records[2], want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		file, err := renderExport(FormatJSON, "title", "links", rows)
+		if err != nil {
+			t.Fatalf("renderExport(json) error = %v", err)
+		}
+		var got []exportRow
+		if err := json.NewDecoder(file.Reader).Decode(&got); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		if len(got) != 2 || got[0].Title != "Title [A]" || got[0].URL != "https://example.com/a?x=1&y=2" {
+			t.Errorf("decoded rows = %+v", got)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		file, err := renderExport(FormatMarkdown, "2026/10/17 のリンク", "links", rows)
+		if err != nil {
+			t.Fatalf("renderExport(markdown) error = %v", err)
+		}
+		b, _ := io.ReadAll(file.Reader)
+		got := string(b)
+		for _, want := range []string{
+			"# 2026/10/17 のリンク\n",
+			`- [Title \[A\]](<https://example.com/a?x=1&y=2>) — alice, 2026-10-17T09:30:00+09:00 ([message](https://discord.com/channels/100/200/300))`,
+			"- [https://example.org/b](<https://example.org/b>)",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("markdown does not contain %q:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("markdown escapes", func(t *testing.T) {
+		rows := []exportRow{
+			{URL: "https://en.wikipedia.org/wiki/Go_(programming_language)", Title: `Go [lang] \ wiki`},
+			{URL: "https://example.com/<a>"},
+		}
+		file, err := renderExport(FormatMarkdown, "title", "links", rows)
+		if err != nil {
+			t.Fatalf("renderExport(markdown) error = %v", err)
+		}
+		b, _ := io.ReadAll(file.Reader)
+		got := string(b)
+		for _, want := range []string{
+			`- [Go \[lang\] \\ wiki](<https://en.wikipedia.org/wiki/Go_(programming_language)>)`,
+			"- [https://example.com/<a>](<https://example.com/%3Ca%3E>)",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("markdown does not contain %q:\n%s", want, got)
+			}
+		}
+	})
+}
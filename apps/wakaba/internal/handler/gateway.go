@@ -17,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/repository"
 )
 
 // API Gateway からの Webhook Request を受け取り処理するハンドラ
@@ -54,6 +55,16 @@ func HandleGateway(ctx context.Context, request events.APIGatewayProxyRequest, p
 		})
 	}
 
+	// オートコンプリートは 3 秒以内に候補を返す必要があるので、非同期にせずここで応答する
+	if interaction.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		return jsonResponse(discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: autocompleteChoices(ctx, &interaction),
+			},
+		})
+	}
+
 	payload := WorkerRequest{
 		InteractionID:    interaction.ID,
 		InteractionToken: interaction.Token,
@@ -61,6 +72,14 @@ func HandleGateway(ctx context.Context, request events.APIGatewayProxyRequest, p
 		ApplicationID:    interaction.AppID,
 		GuildID:          interaction.GuildID,
 	}
+	if interaction.Member != nil {
+		payload.MemberPermissions = interaction.Member.Permissions
+		if interaction.Member.User != nil {
+			payload.UserID = interaction.Member.User.ID
+		}
+	} else if interaction.User != nil {
+		payload.UserID = interaction.User.ID
+	}
 
 	// コマンドの場合
 	if interaction.Type == discordgo.InteractionApplicationCommand {
@@ -112,6 +131,30 @@ func HandleGateway(ctx context.Context, request events.APIGatewayProxyRequest, p
 	return events.APIGatewayProxyResponse{StatusCode: 400, Body: "unknown interaction type"}, nil
 }
 
+// 入力中のオプションの候補を返す。候補がない場合や取得に失敗した場合は空
+func autocompleteChoices(ctx context.Context, interaction *discordgo.Interaction) []*discordgo.ApplicationCommandOptionChoice {
+	data := interaction.ApplicationCommandData()
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if data.Name != "list" || len(data.Options) == 0 {
+		return choices
+	}
+
+	repo, err := repository.NewTodoRepository(ctx)
+	if err != nil {
+		log.Printf("Repository init failed: %v", err)
+		return choices
+	}
+	c, err := todoAutocompleteChoices(ctx, repo, interaction.ChannelID, data.Options[0].Options)
+	if err != nil {
+		log.Printf("Failed to get autocomplete choices: %v", err)
+		return choices
+	}
+	if c != nil {
+		choices = c
+	}
+	return choices
+}
+
 func errorResponse(err error) (events.APIGatewayProxyResponse, error) {
 	log.Printf("Failed to invoke self: %v", err)
 	return jsonResponse(discordgo.InteractionResponse{
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+// /summarize の group_by 引数で指定できるまとめ方
+const (
+	GroupByNone        = "none"
+	GroupByAuthor      = "author"
+	GroupByDomain      = "domain"
+	GroupByHour        = "hour"
+	GroupByContentType = "content_type"
+)
+
+// /summarize の sort 引数で指定できる並び順
+const (
+	SortPosted    = "posted"
+	SortDomain    = "domain"
+	SortReactions = "reactions"
+)
+
+func isValidGroupBy(groupBy string) bool {
+	switch groupBy {
+	case "", GroupByNone, GroupByAuthor, GroupByDomain, GroupByHour, GroupByContentType:
+		return true
+	}
+	return false
+}
+
+func isValidSort(sortBy string) bool {
+	switch sortBy {
+	case "", SortPosted, SortDomain, SortReactions:
+		return true
+	}
+	return false
+}
+
+// 見出しごとにまとめたリンクの位置
+type linkGroup struct {
+	Key     string // 見出し。group_by が none の場合は空
+	Indexes []int  // links と previews の位置
+}
+
+// リンクを group_by でまとめ、それぞれを sort で並べ替える
+// 時間帯でまとめた場合は時刻順、それ以外はリンクの多い順に見出しを並べる
+// group_by が none の場合は、チャンネル・スレッドのまとまりを崩さずにその中で並べ替える
+// top を指定した場合は、まとめずにスコアの高い順に並べる
+func arrangeLinks(links []discord.CapturedLink, previews []linkPreview, opts summaryOptions) []linkGroup {
+	if opts.Top > 0 {
+		return []linkGroup{{Indexes: rankLinks(links, opts.Weights, opts.Top)}}
+	}
+
+	indexes := make([]int, len(links))
+	for i := range links {
+		indexes[i] = i
+	}
+
+	// links はチャンネル・スレッドごとに投稿順に並んでいる
+	segment := make([]int, len(links))
+	for i := 1; i < len(links); i++ {
+		segment[i] = segment[i-1]
+		if links[i].ChannelID != links[i-1].ChannelID {
+			segment[i]++
+		}
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		i, j := indexes[a], indexes[b]
+		if opts.GroupBy == "" || opts.GroupBy == GroupByNone {
+			if segment[i] != segment[j] {
+				return segment[i] < segment[j]
+			}
+		}
+		return lessLink(links[i], links[j], opts.Sort)
+	})
+
+	if opts.GroupBy == "" || opts.GroupBy == GroupByNone {
+		return []linkGroup{{Indexes: indexes}}
+	}
+
+	var groups []linkGroup
+	byKey := map[string]int{}
+	for _, i := range indexes {
+		var preview *linkPreview
+		if previews != nil {
+			preview = &previews[i]
+		}
+		key := groupKey(links[i], preview, opts)
+		g, ok := byKey[key]
+		if !ok {
+			g = len(groups)
+			byKey[key] = g
+			groups = append(groups, linkGroup{Key: key})
+		}
+		groups[g].Indexes = append(groups[g].Indexes, i)
+	}
+
+	if opts.GroupBy == GroupByHour {
+		earliest := func(g linkGroup) time.Time {
+			t := links[g.Indexes[0]].PostedAt
+			for _, i := range g.Indexes[1:] {
+				if links[i].PostedAt.Before(t) {
+					t = links[i].PostedAt
+				}
+			}
+			return t
+		}
+		sort.SliceStable(groups, func(a, b int) bool {
+			return earliest(groups[a]).Before(earliest(groups[b]))
+		})
+		return groups
+	}
+	sort.SliceStable(groups, func(a, b int) bool {
+		return len(groups[a].Indexes) > len(groups[b].Indexes)
+	})
+	return groups
+}
+
+// sort の指定でリンクの順番を比べる。同じ場合は投稿順
+func lessLink(a, b discord.CapturedLink, sortBy string) bool {
+	switch sortBy {
+	case SortDomain:
+		if da, db := linkDomain(a.URL), linkDomain(b.URL); da != db {
+			return da < db
+		}
+	case SortReactions:
+		if ra, rb := a.TotalReactions(), b.TotalReactions(); ra != rb {
+			return ra > rb
+		}
+	}
+	return a.PostedAt.Before(b.PostedAt)
+}
+
+// リンクの見出しを返す
+func groupKey(link discord.CapturedLink, preview *linkPreview, opts summaryOptions) string {
+	switch opts.GroupBy {
+	case GroupByAuthor:
+		if link.AuthorName == "" {
+			return "(unknown)"
+		}
+		return "@" + link.AuthorName
+	case GroupByDomain:
+		return linkDomain(link.URL)
+	case GroupByHour:
+		t := link.PostedAt.In(opts.Location)
+		if opts.MultiDay {
+			return t.Format("01/02 15:00〜")
+		}
+		return t.Format("15:00〜")
+	case GroupByContentType:
+		return contentTypeOf(link, preview)
+	}
+	return ""
+}
+
+// 正規化した URL のホスト名を返す (www. を除き、twitter.com は x.com にまとめる)
+func linkDomain(rawURL string) string {
+	u, err := url.Parse(util.CanonicalizeURL(rawURL))
+	if err != nil || u.Hostname() == "" {
+		return "(unknown)"
+	}
+	return u.Hostname()
+}
+
+// リンクの種類を分類する
+// リンク先の Content-Type がわかる場合はそれを、わからない場合は URL から推測する
+func contentTypeOf(link discord.CapturedLink, preview *linkPreview) string {
+	if preview != nil && preview.Meta != nil && preview.Meta.ContentType != "" {
+		ct, _, _ := strings.Cut(preview.Meta.ContentType, ";")
+		ct = strings.ToLower(strings.TrimSpace(ct))
+		switch {
+		case strings.HasPrefix(ct, "image/"):
+			return "画像"
+		case strings.HasPrefix(ct, "video/"), strings.HasPrefix(ct, "audio/"):
+			return "動画・音声"
+		case ct == "application/pdf":
+			return "ドキュメント"
+		}
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return "その他"
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg":
+		return "画像"
+	case ".mp4", ".mov", ".webm", ".mp3", ".m4a", ".wav":
+		return "動画・音声"
+	case ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx":
+		return "ドキュメント"
+	}
+
+	switch domain := linkDomain(link.URL); domain {
+	case "youtube.com", "nicovideo.jp", "twitch.tv", "vimeo.com", "tiktok.com", "open.spotify.com":
+		return "動画・音声"
+	case "github.com", "gitlab.com", "bitbucket.org", "gist.github.com":
+		return "コード"
+	case "x.com", "bsky.app", "threads.net", "instagram.com", "facebook.com", "reddit.com":
+		return "SNS"
+	case "tenor.com", "giphy.com", "media.tenor.com", "imgur.com", "i.imgur.com":
+		return "画像"
+	}
+	if link.Origin == discord.SourceAttachments {
+		return "ファイル"
+	}
+	return "ウェブページ"
+}
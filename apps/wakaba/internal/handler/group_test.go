@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+func TestArrangeLinks(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	at := func(hour, min int) time.Time { return time.Date(2026, 10, 17, hour, min, 0, 0, jst) }
+
+	links := []discord.CapturedLink{
+		{URL: "https://github.com/a", PostedAt: at(9, 0), ChannelID: "c1", AuthorName: "alice"},
+		{URL: "https://www.youtube.com/watch?v=1", PostedAt: at(9, 30), ChannelID: "c1", AuthorName: "bob", ReactionCount: 3},
+		{URL: "https://twitter.com/x/status/1", PostedAt: at(10, 0), ChannelID: "c1", AuthorName: "alice", ReactionCount: 5},
+		{URL: "https://github.com/b", PostedAt: at(8, 0), ChannelID: "c2", AuthorName: "alice", ReactionCount: 1},
+		{URL: "https://example.com/report.pdf", PostedAt: at(11, 0), ChannelID: "c2", AuthorName: "carol"},
+	}
+	opts := func(groupBy, sortBy string) summaryOptions {
+		return summaryOptions{GroupBy: groupBy, Sort: sortBy, Location: jst}
+	}
+	keysAndIndexes := func(groups []linkGroup) ([]string, [][]int) {
+		var keys []string
+		var indexes [][]int
+		for _, g := range groups {
+			keys = append(keys, g.Key)
+			indexes = append(indexes, g.Indexes)
+		}
+		return keys, indexes
+	}
+
+	tests := []struct {
+		name        string
+		opts        summaryOptions
+		wantKeys    []string
+		wantIndexes [][]int
+	}{
+		{
+			name:        "none keeps channel segments",
+			opts:        opts("", ""),
+			wantKeys:    []string{""},
+			wantIndexes: [][]int{{0, 1, 2, 3, 4}},
+		},
+		{
+			name:        "none sorted by reactions within channels",
+			opts:        opts(GroupByNone, SortReactions),
+			wantKeys:    []string{""},
+			wantIndexes: [][]int{{2, 1, 0, 3, 4}},
+		},
+		{
+			name:        "author by size",
+			opts:        opts(GroupByAuthor, SortPosted),
+			wantKeys:    []string{"@alice", "@bob", "@carol"},
+			wantIndexes: [][]int{{3, 0, 2}, {1}, {4}},
+		},
+		{
+			name:        "domain canonicalized",
+			opts:        opts(GroupByDomain, ""),
+			wantKeys:    []string{"github.com", "youtube.com", "x.com", "example.com"},
+			wantIndexes: [][]int{{3, 0}, {1}, {2}, {4}},
+		},
+		{
+			name:        "hour in time order",
+			opts:        opts(GroupByHour, SortReactions),
+			wantKeys:    []string{"08:00〜", "09:00〜", "10:00〜", "11:00〜"},
+			wantIndexes: [][]int{{3}, {1, 0}, {2}, {4}},
+		},
+		{
+			name: "content type",
+			opts: opts(GroupByContentType, SortDomain),
+			// 同じ件数の見出しは、並べ替えた後の最初のリンクの順
+			wantKeys:    []string{"コード", "ドキュメント", "SNS", "動画・音声"},
+			wantIndexes: [][]int{{3, 0}, {4}, {2}, {1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, indexes := keysAndIndexes(arrangeLinks(links, nil, tt.opts))
+			if !reflect.DeepEqual(keys, tt.wantKeys) || !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Errorf("arrangeLinks() = %v %v, want %v %v", keys, indexes, tt.wantKeys, tt.wantIndexes)
+			}
+		})
+	}
+}
+
+func TestContentTypeOf(t *testing.T) {
+	tests := []struct {
+		link    discord.CapturedLink
+		preview *linkPreview
+		want    string
+	}{
+		{link: discord.CapturedLink{URL: "https://example.com/a.PNG"}, want: "画像"},
+		{link: discord.CapturedLink{URL: "https://youtu.be/abc"}, want: "動画・音声"},
+		{link: discord.CapturedLink{URL: "https://example.com/download"}, preview: &linkPreview{Meta: &util.PageMetadata{ContentType: "application/pdf; qs=0.1"}}, want: "ドキュメント"},
+		{link: discord.CapturedLink{URL: "https://cdn.discordapp.com/attachments/1/2/data.zip", Origin: discord.SourceAttachments}, want: "ファイル"},
+		{link: discord.CapturedLink{URL: "https://blog.example/post"}, want: "ウェブページ"},
+	}
+	for _, tt := range tests {
+		if got := contentTypeOf(tt.link, tt.preview); got != tt.want {
+			t.Errorf("contentTypeOf(%s) = %s, want %s", tt.link.URL, got, tt.want)
+		}
+	}
+}
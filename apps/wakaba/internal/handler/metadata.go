@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/repository"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+const (
+	// 取得できたメタデータをキャッシュする期間
+	MetadataCacheTTL = 7 * 24 * time.Hour
+	// 取得に失敗したことをキャッシュする期間
+	MetadataNegativeCacheTTL = time.Hour
+
+	// 同時に取得するリンクの数
+	MetadataWorkers = 16
+	// 同じホストに対して同時に取得するリンクの数
+	MetadataPerHost = 2
+	// 同じホストに対してリクエストを開始する最小の間隔
+	MetadataHostDelay = 300 * time.Millisecond
+	// メタデータの取得にかける最大の時間（過ぎたら取得できた分だけで表示する）
+	// 1 つのコマンドの中で FetchAll を何度呼んでも、最初の呼び出しからこの時間で打ち切る
+	MetadataDeadline = 10 * time.Second
+)
+
+// リンク先のメタデータの取得結果
+type linkPreview struct {
+	Meta    *util.PageMetadata // 取得に失敗した場合は nil
+	Pending bool               // 制限時間内に取得が終わらなかった
+}
+
+// キャッシュを参照しながらリンク先のメタデータを取得する
+// 1 つのコマンドの中で使い回し、取得した結果・制限時間・ホストごとの並列数を共有する
+type metadataFetcher struct {
+	cache    repository.LinkCache // nil の場合はキャッシュしない
+	fetch    func(ctx context.Context, url string) (*util.PageMetadata, error)
+	now      func() time.Time
+	pool     *util.FetchPool
+	deadline time.Duration
+
+	mu      sync.Mutex
+	expires time.Time                     // 最初の FetchAll の呼び出しから deadline 後
+	fetched map[string]*util.PageMetadata // 取得を終えたリンク (CanonicalizeURL したもの) の結果
+}
+
+func newMetadataFetcher(ctx context.Context) *metadataFetcher {
+	f := &metadataFetcher{
+		fetch: util.FetchPageMetadataContext,
+		now:   time.Now,
+		pool: &util.FetchPool{
+			Workers: MetadataWorkers,
+			PerHost: MetadataPerHost,
+			Delay:   MetadataHostDelay,
+		},
+		deadline: MetadataDeadline,
+	}
+
+	cache, err := repository.NewLinkCacheRepository(ctx)
+	if err != nil {
+		// キャッシュが使えなくてもメタデータの取得は続ける
+		log.Printf("Link cache init failed: %v", err)
+		return f
+	}
+	f.cache = cache
+	return f
+}
+
+// 各リンク先のメタデータを並行して取得し、リンクと同じ順序で返す
+// 制限時間を過ぎた場合は、それまでに取得できた分を返し、残りは Pending にする
+// すでに取得を終えたリンクは取得し直さない
+func (f *metadataFetcher) FetchAll(ctx context.Context, links []discord.CapturedLink) []linkPreview {
+	if f.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, f.expiresAt())
+		defer cancel()
+	}
+
+	previews := make([]linkPreview, len(links))
+	var urls []string
+	var indexes []int
+	f.mu.Lock()
+	for i, l := range links {
+		if meta, ok := f.fetched[util.CanonicalizeURL(l.URL)]; ok {
+			previews[i].Meta = meta
+			continue
+		}
+		urls = append(urls, l.URL)
+		indexes = append(indexes, i)
+	}
+	f.mu.Unlock()
+
+	done := f.pool.Run(ctx, urls, func(ctx context.Context, j int) bool {
+		meta, ok := f.Fetch(ctx, urls[j])
+		previews[indexes[j]].Meta = meta
+		if ok {
+			f.mu.Lock()
+			if f.fetched == nil {
+				f.fetched = map[string]*util.PageMetadata{}
+			}
+			f.fetched[util.CanonicalizeURL(urls[j])] = meta
+			f.mu.Unlock()
+		}
+		return ok
+	})
+
+	for j, i := range indexes {
+		previews[i].Pending = !done[j]
+	}
+	return previews
+}
+
+// 最初の呼び出しから deadline 後の時刻を返す
+func (f *metadataFetcher) expiresAt() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.expires.IsZero() {
+		f.expires = f.now().Add(f.deadline)
+	}
+	return f.expires
+}
+
+// キャッシュがあればキャッシュを、なければリンク先から取得したメタデータを返す
+// 取得に失敗した場合（失敗がキャッシュされている場合を含む）は nil を返す
+// ctx の終了で取得を中断した場合は false を返し、失敗としてキャッシュしない
+func (f *metadataFetcher) Fetch(ctx context.Context, rawURL string) (*util.PageMetadata, bool) {
+	key := util.CanonicalizeURL(rawURL)
+	now := f.now()
+
+	if f.cache != nil {
+		entry, err := f.cache.GetLinkMetadata(ctx, key)
+		if err != nil {
+			log.Printf("Failed to get link cache for %s: %v", key, err)
+		} else if entry != nil && now.Unix() < entry.ExpiresAt {
+			if entry.Failed {
+				return nil, true
+			}
+			return &entry.Metadata, true
+		}
+	}
+
+	meta, err := f.fetch(ctx, rawURL)
+	if err != nil && ctx.Err() != nil {
+		return nil, false
+	}
+
+	entry := &repository.LinkMetadata{
+		URL:       key,
+		FetchedAt: now.Unix(),
+		ExpiresAt: now.Add(MetadataCacheTTL).Unix(),
+	}
+	if err != nil {
+		log.Printf("Failed to fetch metadata for %s: %v", rawURL, err)
+		entry.Failed = true
+		entry.Error = err.Error()
+		entry.ExpiresAt = now.Add(MetadataNegativeCacheTTL).Unix()
+		meta = nil
+	} else {
+		entry.Metadata = *meta
+	}
+
+	if f.cache != nil {
+		if err := f.cache.SaveLinkMetadata(ctx, entry); err != nil {
+			log.Printf("Failed to save link cache for %s: %v", key, err)
+		}
+	}
+
+	return meta, true
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+	"github.com/yotu/wakaba/internal/repository"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+func TestMetadataFetcherCache(t *testing.T) {
+	var calls atomic.Int32
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	f := &metadataFetcher{
+		cache: repository.NewMemoryLinkCache(),
+		fetch: func(ctx context.Context, u string) (*util.PageMetadata, error) {
+			calls.Add(1)
+			if u == "https://broken.example/" {
+				return nil, errors.New("status code: 500")
+			}
+			return &util.PageMetadata{Title: "title of " + u}, nil
+		},
+		now: func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	// 1 回目はリンク先から取得する
+	if got, _ := f.Fetch(ctx, "https://Example.com/a#section"); got == nil || got.Title != "title of https://Example.com/a#section" {
+		t.Fatalf("Fetch() = %+v", got)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("calls = %d, want 1", calls.Load())
+	}
+
+	// 正規化すると同じ URL はキャッシュから返す
+	if got, _ := f.Fetch(ctx, "https://example.com/a"); got == nil || got.Title != "title of https://Example.com/a#section" {
+		t.Errorf("Fetch() from cache = %+v", got)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1 (cache hit)", calls.Load())
+	}
+
+	// 失敗もキャッシュし、再取得しない
+	if got, _ := f.Fetch(ctx, "https://broken.example/"); got != nil {
+		t.Errorf("Fetch() broken = %+v, want nil", got)
+	}
+	if got, _ := f.Fetch(ctx, "https://broken.example/"); got != nil {
+		t.Errorf("Fetch() broken from cache = %+v, want nil", got)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2 (negative cache hit)", calls.Load())
+	}
+
+	// 失敗のキャッシュは短い期間で切れる
+	now = now.Add(MetadataNegativeCacheTTL + time.Minute)
+	f.Fetch(ctx, "https://broken.example/")
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3 (negative cache expired)", calls.Load())
+	}
+	f.Fetch(ctx, "https://example.com/a")
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3 (positive cache still valid)", calls.Load())
+	}
+
+	// 成功のキャッシュも期限が切れたら再取得する
+	now = now.Add(MetadataCacheTTL)
+	f.Fetch(ctx, "https://example.com/a")
+	if calls.Load() != 4 {
+		t.Errorf("calls = %d, want 4 (cache expired)", calls.Load())
+	}
+}
+
+func TestMetadataFetcherFetchAll(t *testing.T) {
+	f := &metadataFetcher{
+		cache: repository.NewMemoryLinkCache(),
+		fetch: func(ctx context.Context, u string) (*util.PageMetadata, error) {
+			if u == "https://b.example/" {
+				return nil, errors.New("timeout")
+			}
+			return &util.PageMetadata{Title: u}, nil
+		},
+		now:  time.Now,
+		pool: &util.FetchPool{Workers: 2, PerHost: 1},
+	}
+
+	links := []discord.CapturedLink{{URL: "https://a.example/"}, {URL: "https://b.example/"}, {URL: "https://c.example/"}}
+	previews := f.FetchAll(context.Background(), links)
+
+	if len(previews) != 3 {
+		t.Fatalf("len(previews) = %d, want 3", len(previews))
+	}
+	if previews[0].Meta == nil || previews[0].Meta.Title != "https://a.example/" || previews[0].Pending {
+		t.Errorf("previews[0] = %+v", previews[0])
+	}
+	if previews[1].Meta != nil || previews[1].Pending {
+		t.Errorf("previews[1] = %+v, want failed but not pending", previews[1])
+	}
+	if previews[2].Meta == nil || previews[2].Meta.Title != "https://c.example/" {
+		t.Errorf("previews[2] = %+v", previews[2])
+	}
+}
+
+func TestMetadataFetcherDeadline(t *testing.T) {
+	cache := repository.NewMemoryLinkCache()
+	f := &metadataFetcher{
+		cache: cache,
+		fetch: func(ctx context.Context, u string) (*util.PageMetadata, error) {
+			if u == "https://slow.example/" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &util.PageMetadata{Title: u}, nil
+		},
+		now:      time.Now,
+		pool:     &util.FetchPool{Workers: 2, PerHost: 1},
+		deadline: 50 * time.Millisecond,
+	}
+
+	links := []discord.CapturedLink{{URL: "https://fast.example/"}, {URL: "https://slow.example/"}}
+	previews := f.FetchAll(context.Background(), links)
+
+	if previews[0].Meta == nil || previews[0].Pending {
+		t.Errorf("previews[0] = %+v, want fetched", previews[0])
+	}
+	if previews[1].Meta != nil || !previews[1].Pending {
+		t.Errorf("previews[1] = %+v, want pending", previews[1])
+	}
+
+	// 中断した取得は失敗としてキャッシュしない
+	if entry, _ := cache.GetLinkMetadata(context.Background(), "https://slow.example/"); entry != nil {
+		t.Errorf("interrupted fetch was cached: %+v", entry)
+	}
+}
+
+func TestMetadataFetcherDeadlineUsesClock(t *testing.T) {
+	f := &metadataFetcher{
+		fetch: func(ctx context.Context, u string) (*util.PageMetadata, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		// 制限時間は f.now から数えるので、1 時間前の時刻ならすでに過ぎている
+		now:      func() time.Time { return time.Now().Add(-time.Hour) },
+		pool:     &util.FetchPool{Workers: 1, PerHost: 1},
+		deadline: time.Minute,
+	}
+
+	start := time.Now()
+	previews := f.FetchAll(context.Background(), []discord.CapturedLink{{URL: "https://slow.example/"}})
+	if !previews[0].Pending {
+		t.Errorf("previews[0] = %+v, want pending", previews[0])
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FetchAll took %v, want the deadline from f.now", elapsed)
+	}
+}
+
+func TestMetadataFetcherSharedAcrossCalls(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	f := &metadataFetcher{
+		fetch: func(ctx context.Context, u string) (*util.PageMetadata, error) {
+			mu.Lock()
+			calls[u]++
+			mu.Unlock()
+			if u == "https://slow.example/" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &util.PageMetadata{Title: u}, nil
+		},
+		now:      time.Now,
+		pool:     &util.FetchPool{Workers: 2, PerHost: 1},
+		deadline: 50 * time.Millisecond,
+	}
+
+	// キーワードの判定 (チャンネルごとに呼ばれる) で取得したタイトルを、with_title でも使う
+	f.FetchAll(context.Background(), []discord.CapturedLink{{URL: "https://a.example/"}, {URL: "https://slow.example/"}})
+	start := time.Now()
+	previews := f.FetchAll(context.Background(), []discord.CapturedLink{{URL: "https://a.example/?utm_source=x"}, {URL: "https://slow.example/"}})
+
+	if previews[0].Meta == nil || previews[0].Pending || calls["https://a.example/"] != 1 || calls["https://a.example/?utm_source=x"] != 0 {
+		t.Errorf("previews[0] = %+v, calls = %v, want reused", previews[0], calls)
+	}
+	// 制限時間は最初の呼び出しから数えるので、2 回目の呼び出しは待たずに打ち切る
+	if !previews[1].Pending {
+		t.Errorf("previews[1] = %+v, want pending", previews[1])
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Millisecond {
+		t.Errorf("second FetchAll took %v, want the shared deadline", elapsed)
+	}
+}
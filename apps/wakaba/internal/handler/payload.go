@@ -3,28 +3,67 @@ package handler
 // WorkerRequest is a unified payload for the async worker lambda.
 type WorkerRequest struct {
 	// Common fields
-	Type             string `json:"type"` // "command" or "component"
+	Type             string `json:"type"` // "command", "component" or "digest"
 	InteractionID    string `json:"interaction_id"`
 	InteractionToken string `json:"interaction_token"`
 	ChannelID        string `json:"channel_id"`
 	ApplicationID    string `json:"application_id"`
 	GuildID          string `json:"guild_id"`
+	UserID           string `json:"user_id"`
+	// Permissions of the invoking member (0 in DMs)
+	MemberPermissions int64 `json:"member_permissions,omitempty"`
 
 	// For Commands
-	CommandName string          `json:"command_name,omitempty"`
-	CommandArgs map[string]any  `json:"command_args,omitempty"`
+	CommandName string         `json:"command_name,omitempty"`
+	CommandArgs map[string]any `json:"command_args,omitempty"`
 
 	// For Components (Buttons)
 	CustomID string `json:"custom_id,omitempty"`
+
+	// For scheduled digests (no interaction token; the result is posted to this channel with the bot token)
+	TargetChannelID string `json:"target_channel_id,omitempty"`
 }
 
 // Command Arguments structures
 type SummarizeArgs struct {
-	DateArg   string `json:"date_arg"`
-	WithTitle bool   `json:"with_title"`
+	DateArg        string `json:"date"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	WithTitle      bool   `json:"with_title"`
+	Format         string `json:"format"` // "text", "markdown", "csv" or "json"
+	Dedupe         bool   `json:"dedupe"`
+	Sources        string `json:"sources"`         // "content,embeds,attachments,forwards,replies" のうち抽出する場所
+	IncludeThreads bool   `json:"include_threads"` // スレッド (フォーラムチャンネルの場合は投稿) も対象にする
+	Scope          string `json:"scope"`           // "channel", "category" or "guild"
+	User           string `json:"user"`            // 投稿したユーザーの ID
+	Domain         string `json:"domain"`          // 対象にするドメイン (カンマ区切り)
+	ExcludeDomain  string `json:"exclude_domain"`  // 対象にしないドメイン (カンマ区切り)
+	Keyword        string `json:"keyword"`         // メッセージかリンク先のタイトルに含まれる文字列
+	HideAuthors    bool   `json:"hide_authors"`    // まとめに投稿者を表示しない
+	GroupBy        string `json:"group_by"`        // "none", "author", "domain", "hour" or "content_type"
+	Sort           string `json:"sort"`            // "posted", "domain" or "reactions"
+	Top            int    `json:"top"`             // 人気順の上位 N 件だけを表示する
+	Score          string `json:"score"`           // 人気順のスコアの重み ("reactions:1,replies:2,shares:1")
+}
+
+type ConfigArgs struct {
+	SubCommand string `json:"sub_command"`
+	Zone       string `json:"zone"`
+	Scope      string `json:"scope"` // "guild" or "user"
+}
+
+type DigestArgs struct {
+	SubCommand string `json:"sub_command"`
+	Channel    string `json:"channel"` // まとめるチャンネルの ID (省略時は実行したチャンネル)
+	Time       string `json:"time"`    // "09:00"
+	Target     string `json:"target"`  // 投稿先のチャンネルの ID (省略時は実行したチャンネル)
 }
 
 type TodoListArgs struct {
 	SubCommand string `json:"sub_command"`
+	Name       string `json:"name"` // create で作るリストの名前 (省略時はチャンネルの既定のリスト)
+	List       string `json:"list"` // 操作するリストの名前 (省略時はチャンネルの既定のリスト)
 	Content    string `json:"content"`
+	Item       int    `json:"item"`     // 対象のタスクの番号 (1 始まり)
+	Position   int    `json:"position"` // move の移動先の番号 (1 始まり)
 }
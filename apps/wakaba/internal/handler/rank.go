@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yotu/wakaba/internal/discord"
+)
+
+// /summarize top:N で表示できる最大件数
+const MaxTopLinks = 50
+
+// 人気順に並べるときのスコアの重み
+type scoreWeights struct {
+	Reactions float64 // リアクション 1 つあたり
+	Replies   float64 // 返信 1 件あたり
+	Shares    float64 // 同じリンクの共有 1 回あたり
+}
+
+// score 引数を省略した場合の重み
+var defaultScoreWeights = scoreWeights{Reactions: 1, Replies: 2, Shares: 1}
+
+// "reactions:1,replies:2,shares:0.5" のような重みの指定を解釈する
+// 指定しなかった項目はデフォルトの重みになる
+func parseScoreWeights(input string) (scoreWeights, error) {
+	w := defaultScoreWeights
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok {
+			name, value, ok = strings.Cut(field, "=")
+		}
+		if !ok {
+			return w, fmt.Errorf("invalid weight: %s", field)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 {
+			return w, fmt.Errorf("invalid weight: %s", field)
+		}
+		switch strings.ToLower(name) {
+		case "reactions":
+			w.Reactions = v
+		case "replies":
+			w.Replies = v
+		case "shares":
+			w.Shares = v
+		default:
+			return w, fmt.Errorf("unknown score item: %s", name)
+		}
+	}
+	return w, nil
+}
+
+// リンクのスコアを返す
+func (w scoreWeights) score(link discord.CapturedLink) float64 {
+	return w.Reactions*float64(link.TotalReactions()) +
+		w.Replies*float64(link.TotalReplies()) +
+		w.Shares*float64(link.ShareCount())
+}
+
+// スコアの高い順に上位 n 件の位置を返す。同じスコアの場合は先に投稿されたもの
+func rankLinks(links []discord.CapturedLink, w scoreWeights, n int) []int {
+	indexes := make([]int, len(links))
+	for i := range links {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		sa, sb := w.score(links[indexes[a]]), w.score(links[indexes[b]])
+		if sa != sb {
+			return sa > sb
+		}
+		return links[indexes[a]].PostedAt.Before(links[indexes[b]].PostedAt)
+	})
+	if n > 0 && len(indexes) > n {
+		indexes = indexes[:n]
+	}
+	return indexes
+}
+
+// リアクション・返信・共有の数を " (👍 3 ・ 💬 1 ・ ×2)" のように返す
+func engagementLabel(link discord.CapturedLink) string {
+	var parts []string
+	if n := link.TotalReactions(); n > 0 {
+		parts = append(parts, fmt.Sprintf("👍 %d", n))
+	}
+	if n := link.TotalReplies(); n > 0 {
+		parts = append(parts, fmt.Sprintf("💬 %d", n))
+	}
+	if n := link.ShareCount(); n > 1 {
+		parts = append(parts, fmt.Sprintf("×%d", n))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, " ・ ") + ")"
+}
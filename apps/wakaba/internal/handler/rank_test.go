@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yotu/wakaba/internal/discord"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    scoreWeights
+		wantErr bool
+	}{
+		{input: "", want: defaultScoreWeights},
+		{input: "reactions:3", want: scoreWeights{Reactions: 3, Replies: 2, Shares: 1}},
+		{input: "Replies=0.5, shares:0", want: scoreWeights{Reactions: 1, Replies: 0.5, Shares: 0}},
+		{input: "reactions", wantErr: true},
+		{input: "reactions:-1", wantErr: true},
+		{input: "stars:1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScoreWeights(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseScoreWeights(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseScoreWeights(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRankLinks(t *testing.T) {
+	base := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	shared := discord.CapturedLink{URL: "https://example.com/shared", PostedAt: base, ReactionCount: 1}
+	shared.Duplicates = []discord.CapturedLink{{ReactionCount: 1}, {ReplyCount: 1}}
+	links := []discord.CapturedLink{
+		shared, // 1 + 1 リアクション、1 返信、3 共有
+		{URL: "https://example.com/reactions", PostedAt: base.Add(time.Minute), ReactionCount: 6},
+		{URL: "https://example.com/replies", PostedAt: base.Add(2 * time.Minute), ReplyCount: 3},
+		{URL: "https://example.com/quiet", PostedAt: base.Add(3 * time.Minute)},
+		{URL: "https://example.com/quiet2", PostedAt: base.Add(4 * time.Minute)},
+	}
+
+	// デフォルト: shared = 2 + 2 + 3 = 7, reactions = 6 + 1 = 7, replies = 6 + 1 = 7, quiet = 1
+	if got, want := rankLinks(links, defaultScoreWeights, 0), []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rankLinks(default) = %v, want %v", got, want)
+	}
+	if got, want := rankLinks(links, scoreWeights{Replies: 1}, 2), []int{2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rankLinks(replies, 2) = %v, want %v", got, want)
+	}
+	if got, want := rankLinks(links, scoreWeights{Reactions: 1}, 3), []int{1, 0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rankLinks(reactions, 3) = %v, want %v", got, want)
+	}
+
+	if got, want := engagementLabel(shared), " (👍 2 ・ 💬 1 ・ ×3)"; got != want {
+		t.Errorf("engagementLabel() = %q, want %q", got, want)
+	}
+	if got := engagementLabel(links[3]); got != "" {
+		t.Errorf("engagementLabel(quiet) = %q, want empty", got)
+	}
+}
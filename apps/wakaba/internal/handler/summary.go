@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/repository"
+)
+
+const (
+	// Embed の description は 4096 文字まで。余裕をもって区切る
+	SummaryPageChars = 3500
+	// 1 ページに表示するリンクの最大行数
+	SummaryPageLines = 40
+)
+
+var markdownReplacer = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`, "[", `\[`, "]", `\]`,
+)
+
+// タイトルなどユーザー由来の文字列を Embed 内で Markdown として解釈されないようにする
+func escapeMarkdown(s string) string {
+	return markdownReplacer.Replace(s)
+}
+
+// 文字列を最大 max 文字（rune 単位）に切り詰める
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+// 行のまとまり（ブロック）をページに分割する
+// ブロックは途中で分割せず、ページの文字数・行数の上限を超える場合は次のページに送る
+func paginateSummary(blocks []string, maxChars, maxLines int) []string {
+	var pages []string
+	var sb strings.Builder
+	chars, lines := 0, 0
+
+	for _, block := range blocks {
+		block = truncateRunes(block, maxChars)
+		blockChars := utf8.RuneCountInString(block)
+		blockLines := strings.Count(block, "\n") + 1
+
+		if sb.Len() > 0 && (chars+blockChars+1 > maxChars || lines+blockLines > maxLines) {
+			pages = append(pages, sb.String())
+			sb.Reset()
+			chars, lines = 0, 0
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+			chars++
+		}
+		sb.WriteString(block)
+		chars += blockChars
+		lines += blockLines
+	}
+
+	if sb.Len() > 0 {
+		pages = append(pages, sb.String())
+	}
+	return pages
+}
+
+func ProcessSummaryComponent(s *discordgo.Session, req *WorkerRequest) error {
+	// CustomID format: "summary:action:page:summaryID"
+	parts := strings.Split(req.CustomID, ":")
+	if len(parts) < 4 || parts[0] != "summary" {
+		return nil
+	}
+
+	action := parts[1]
+	var page int
+	fmt.Sscanf(parts[2], "%d", &page)
+	summaryID := parts[3]
+
+	repo, err := repository.NewSummaryRepository(context.Background())
+	if err != nil {
+		log.Printf("Repository init failed: %v", err)
+		return nil
+	}
+
+	switch action {
+	case "prev":
+		page--
+	case "next":
+		page++
+	}
+
+	summary, err := repo.GetSummary(context.Background(), summaryID, page)
+	if err != nil {
+		log.Printf("Failed to get summary: %v", err)
+		return nil
+	}
+	if summary == nil {
+		// 保存期間を過ぎた場合はボタンを外して知らせる
+		content := "このまとめは保存期間を過ぎたため、ページを切り替えられません。"
+		components := []discordgo.MessageComponent{}
+		return editOriginal(s, req, &discordgo.WebhookEdit{
+			Content:    &content,
+			Components: &components,
+		})
+	}
+
+	embed, components := renderSummaryPage(summary, page)
+	return sendFollowupEmbed(s, req, embed, components)
+}
+
+func renderSummaryPage(summary *repository.Summary, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	totalPages := len(summary.Pages)
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	if page < 0 {
+		page = 0
+	}
+	if page >= totalPages {
+		page = totalPages - 1
+	}
+
+	description := "（リンクはありません）"
+	if page < len(summary.Pages) {
+		description = summary.Pages[page]
+	}
+
+	footer := fmt.Sprintf("Page %d/%d", page+1, totalPages)
+	if summary.Footer != "" {
+		footer += " ・ " + summary.Footer
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       summary.Title,
+		Description: description,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: footer,
+		},
+		Color: 0x00ff00,
+	}
+
+	// 1 ページに収まる場合はボタンを表示しない
+	components := []discordgo.MessageComponent{}
+	if totalPages <= 1 {
+		return embed, components
+	}
+
+	// Navigation Row
+	navComponents := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "⬅️ 前へ",
+			CustomID: fmt.Sprintf("summary:prev:%d:%s", page, summary.ID),
+			Style:    discordgo.PrimaryButton,
+			Disabled: page == 0,
+		},
+		discordgo.Button{
+			Label:    "次へ ➡️",
+			CustomID: fmt.Sprintf("summary:next:%d:%s", page, summary.ID),
+			Style:    discordgo.PrimaryButton,
+			Disabled: page >= totalPages-1,
+		},
+	}
+	components = append(components, discordgo.ActionsRow{
+		Components: navComponents,
+	})
+
+	return embed, components
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPaginateSummary(t *testing.T) {
+	tests := []struct {
+		name      string
+		blocks    []string
+		maxChars  int
+		maxLines  int
+		wantPages []string
+	}{
+		{
+			name:      "fits in one page",
+			blocks:    []string{"https://a.example", "https://b.example"},
+			maxChars:  100,
+			maxLines:  10,
+			wantPages: []string{"https://a.example\nhttps://b.example"},
+		},
+		{
+			name:      "split by lines",
+			blocks:    []string{"a", "b", "c"},
+			maxChars:  100,
+			maxLines:  2,
+			wantPages: []string{"a\nb", "c"},
+		},
+		{
+			name:      "split by chars",
+			blocks:    []string{"aaaa", "bbbb", "cccc"},
+			maxChars:  9,
+			maxLines:  10,
+			wantPages: []string{"aaaa\nbbbb", "cccc"},
+		},
+		{
+			name:      "multi-line block is not split",
+			blocks:    []string{"a", "title\nb", "c"},
+			maxChars:  100,
+			maxLines:  2,
+			wantPages: []string{"a", "title\nb", "c"},
+		},
+		{
+			name:      "multi-byte characters are counted as runes",
+			blocks:    []string{"あいう", "えお"},
+			maxChars:  6,
+			maxLines:  10,
+			wantPages: []string{"あいう\nえお"},
+		},
+		{
+			name:      "no blocks",
+			blocks:    nil,
+			maxChars:  100,
+			maxLines:  10,
+			wantPages: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paginateSummary(tt.blocks, tt.maxChars, tt.maxLines)
+			if strings.Join(got, "|") != strings.Join(tt.wantPages, "|") || len(got) != len(tt.wantPages) {
+				t.Errorf("paginateSummary() = %q, want %q", got, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	long := strings.Repeat("日本語", 100)
+	got := truncateRunes(long, 10)
+	if !utf8.ValidString(got) {
+		t.Errorf("truncateRunes() returned invalid UTF-8: %q", got)
+	}
+	if n := utf8.RuneCountInString(got); n != 10 {
+		t.Errorf("truncateRunes() length = %d, want 10", n)
+	}
+	if got := truncateRunes("short", 10); got != "short" {
+		t.Errorf("truncateRunes() = %q, want %q", got, "short")
+	}
+}
@@ -3,16 +3,23 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/yotu/wakaba/internal/repository"
+	"github.com/yotu/wakaba/internal/todo"
 )
 
 const (
 	PageSize = 10
+
+	// オートコンプリートで返せる候補の最大数と、候補の名前の最大文字数
+	MaxAutocompleteChoices = 25
+	MaxChoiceNameLength    = 100
 )
 
 func ProcessTodoList(s *discordgo.Session, req *WorkerRequest) error {
@@ -26,38 +33,85 @@ func ProcessTodoList(s *discordgo.Session, req *WorkerRequest) error {
 		json.Unmarshal(argBytes, &args)
 	}
 
+	args.Name, args.List = strings.TrimSpace(args.Name), strings.TrimSpace(args.List)
+	for _, name := range []string{args.Name, args.List} {
+		if name == "" {
+			continue
+		}
+		if err := todo.ValidateListName(name); err != nil {
+			return sendError(s, req, err.Error())
+		}
+	}
+
 	switch args.SubCommand {
 	case "create":
-		return handleCreateList(s, req, repo)
+		return handleCreateList(s, req, repo, args.Name)
 	case "add":
-		return handleAddItem(s, req, repo, args.Content)
+		return handleAddItem(s, req, repo, args.List, args.Content)
+	case "edit", "remove", "move":
+		return handleChangeItem(s, req, repo, &args)
 	default:
 		return sendError(s, req, "Unknown subcommand")
 	}
 }
 
-func handleCreateList(s *discordgo.Session, req *WorkerRequest, repo *repository.TodoRepository) error {
-	list, err := repo.GetTodoList(context.Background(), req.ChannelID)
-	if err != nil {
-		return sendError(s, req, fmt.Sprintf("Failed to get list: %v", err))
-	}
+// 他から同時に保存された場合に、リストを読み込み直して変更をやり直す回数
+const TodoSaveRetries = 3
+
+// リストがない場合に add などのサブコマンドが返すエラー
+var errNoTodoList = errors.New("TODOリストがありません。先に `/list create` を実行してください。")
 
-	if list.MessageID != "" {
-		// If a list already exists, maybe we should delete the old message?
-		// For now, just post a new one and update the ID.
+// 名前が name のリストがない場合のエラー
+func noTodoListError(name string) error {
+	if name == "" {
+		return errNoTodoList
 	}
+	return fmt.Errorf("TODOリスト「%s」がありません。先に `/list create name:%s` を実行してください。", name, name)
+}
+
+// 名前が name のリストを読み込んで mutate で変更し、保存する
+// 読み込んだ後に他から保存されていた場合は、読み込みからやり直す
+// mutate がエラーを返した場合は保存せずにそのエラーを返す
+func updateTodoList(ctx context.Context, repo repository.TodoStore, channelID, name string, mutate func(list *repository.TodoList) error) (*repository.TodoList, error) {
+	for attempt := 0; ; attempt++ {
+		list, err := repo.GetTodoList(ctx, channelID, name)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get list: %w", err)
+		}
+		if err := mutate(list); err != nil {
+			return nil, err
+		}
 
-	// Create initial message
-	embed, components := renderTodoList(list, 0)
+		err = repo.SaveTodoList(ctx, list)
+		var conflict *repository.ConflictError
+		if errors.As(err, &conflict) && attempt < TodoSaveRetries {
+			log.Printf("Retrying todo list update: %v", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to save list: %w", err)
+		}
+		return list, nil
+	}
+}
 
-	// If invoking via slash command, use InteractionResponse
-	// But we are in a worker, so we edit the deferred response or send a new message.
-	// Since Slash Command "create" expects a response, we should reply to it.
+// updateTodoList のエラーをユーザーに表示する文に変換する
+func todoErrorMessage(err error) string {
+	var conflict *repository.ConflictError
+	if errors.As(err, &conflict) {
+		return "他の操作と同時に更新されたため保存できませんでした。もう一度お試しください。"
+	}
+	return err.Error()
+}
 
-	// However, usually we want the TODO list to be a persistent message.
-	// Slash Command response is ephemeral or tied to the interaction.
-	// We want to send a NEW message to the channel and track it.
+func handleCreateList(s *discordgo.Session, req *WorkerRequest, repo repository.TodoStore, name string) error {
+	list, err := repo.GetTodoList(context.Background(), req.ChannelID, name)
+	if err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to get list: %v", err))
+	}
 
+	// すでにリストがある場合も新しいメッセージを送り、以降はそちらを更新する
+	embed, components := renderTodoList(list.Page(0, PageSize))
 	embeds := []*discordgo.MessageEmbed{embed}
 	msg, err := s.ChannelMessageSendComplex(req.ChannelID, &discordgo.MessageSend{
 		Embeds:     embeds,
@@ -67,41 +121,211 @@ func handleCreateList(s *discordgo.Session, req *WorkerRequest, repo *repository
 		return sendError(s, req, fmt.Sprintf("Failed to send list message: %v", err))
 	}
 
-	list.MessageID = msg.ID
-	if err := repo.SaveTodoList(context.Background(), list); err != nil {
-		return sendError(s, req, fmt.Sprintf("Failed to save list: %v", err))
+	_, err = updateTodoList(context.Background(), repo, req.ChannelID, name, func(list *repository.TodoList) error {
+		list.MessageID = msg.ID
+		return nil
+	})
+	if err != nil {
+		return sendError(s, req, todoErrorMessage(err))
 	}
 
+	if name != "" {
+		return sendFollowup(s, req, fmt.Sprintf("TODOリスト「%s」を作成しました。", name))
+	}
 	return sendFollowup(s, req, "TODOリストを作成しました。")
 }
 
-func handleAddItem(s *discordgo.Session, req *WorkerRequest, repo *repository.TodoRepository, content string) error {
-	list, err := repo.GetTodoList(context.Background(), req.ChannelID)
+func handleAddItem(s *discordgo.Session, req *WorkerRequest, repo repository.TodoStore, name, content string) error {
+	list, err := updateTodoList(context.Background(), repo, req.ChannelID, name, func(list *repository.TodoList) error {
+		if list.MessageID == "" {
+			return noTodoListError(name)
+		}
+		list.Items = append(list.Items, repository.TodoItem{
+			ID:      list.NewItemID(),
+			Content: content,
+			Status:  "open",
+		})
+		return nil
+	})
 	if err != nil {
-		return sendError(s, req, fmt.Sprintf("Failed to get list: %v", err))
+		return sendError(s, req, todoErrorMessage(err))
+	}
+
+	// Update the pinned message
+	if err := updateListMessage(s, req.ChannelID, list, 0); err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to update message: %v", err))
 	}
 
-	if list.MessageID == "" {
-		return sendError(s, req, "TODOリストがありません。先に `/list create` を実行してください。")
+	return sendFollowup(s, req, fmt.Sprintf("タスクを追加しました: %s", content))
+}
+
+// edit, remove, move サブコマンドで指定した番号 (1 始まり) のタスクを変更する
+func handleChangeItem(s *discordgo.Session, req *WorkerRequest, repo repository.TodoStore, args *TodoListArgs) error {
+	var message string
+	page := (args.Item - 1) / PageSize
+	list, err := updateTodoList(context.Background(), repo, req.ChannelID, args.List, func(list *repository.TodoList) error {
+		if list.MessageID == "" {
+			return noTodoListError(args.List)
+		}
+		switch args.SubCommand {
+		case "edit":
+			old, err := editItem(list, args.Item, args.Content)
+			if err != nil {
+				return err
+			}
+			message = fmt.Sprintf("タスク %d を編集しました: %s → %s", args.Item, old, args.Content)
+		case "remove":
+			removed, err := removeItem(list, args.Item)
+			if err != nil {
+				return err
+			}
+			message = fmt.Sprintf("タスク %d を削除しました: %s", args.Item, removed.Content)
+		case "move":
+			if err := moveItem(list, args.Item, args.Position); err != nil {
+				return err
+			}
+			page = (args.Position - 1) / PageSize
+			message = fmt.Sprintf("タスクを %d 番目から %d 番目に移動しました: %s", args.Item, args.Position, list.Items[args.Position-1].Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(s, req, todoErrorMessage(err))
 	}
 
-	newItem := repository.TodoItem{
-		ID:      fmt.Sprintf("%d", len(list.Items)+1), // Simple ID generation
-		Content: content,
-		Status:  "open",
+	// 変更したタスクのページを表示する
+	if err := updateListMessage(s, req.ChannelID, list, page); err != nil {
+		return sendError(s, req, fmt.Sprintf("Failed to update message: %v", err))
+	}
+
+	return sendFollowup(s, req, message)
+}
+
+// タスクの番号 (1 始まり) が範囲内か確かめる
+func checkItemNumber(list *repository.TodoList, n int) error {
+	if len(list.Items) == 0 {
+		return fmt.Errorf("タスクがありません")
+	}
+	if n < 1 || n > len(list.Items) {
+		return fmt.Errorf("タスクの番号は 1〜%d で指定してください", len(list.Items))
 	}
-	list.Items = append(list.Items, newItem)
+	return nil
+}
 
-	if err := repo.SaveTodoList(context.Background(), list); err != nil {
-		return sendError(s, req, fmt.Sprintf("Failed to save list: %v", err))
+// n 番目のタスクの内容を変更し、変更前の内容を返す
+func editItem(list *repository.TodoList, n int, content string) (string, error) {
+	if err := checkItemNumber(list, n); err != nil {
+		return "", err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", fmt.Errorf("タスクの内容を指定してください")
 	}
+	old := list.Items[n-1].Content
+	list.Items[n-1].Content = content
+	return old, nil
+}
 
-	// Update the pinned message
-	if err := updateListMessage(s, req.ChannelID, list, 0); err != nil {
-		return sendError(s, req, fmt.Sprintf("Failed to update message: %v", err))
+// n 番目のタスクを削除し、削除したタスクを返す
+func removeItem(list *repository.TodoList, n int) (repository.TodoItem, error) {
+	if err := checkItemNumber(list, n); err != nil {
+		return repository.TodoItem{}, err
 	}
+	removed := list.Items[n-1]
+	list.Items = append(list.Items[:n-1], list.Items[n:]...)
+	return removed, nil
+}
 
-	return sendFollowup(s, req, fmt.Sprintf("タスクを追加しました: %s", content))
+// from 番目のタスクを to 番目に移動する
+func moveItem(list *repository.TodoList, from, to int) error {
+	if err := checkItemNumber(list, from); err != nil {
+		return err
+	}
+	if to < 1 || to > len(list.Items) {
+		return fmt.Errorf("移動先は 1〜%d で指定してください", len(list.Items))
+	}
+	item := list.Items[from-1]
+	items := append(list.Items[:from-1:from-1], list.Items[from:]...)
+	items = append(items[:to-1], append([]repository.TodoItem{item}, items[to-1:]...)...)
+	list.Items = items
+	return nil
+}
+
+// 入力中の番号または内容に一致するタスクを、オートコンプリートの候補として返す
+func todoItemChoices(list *repository.TodoList, input string) []*discordgo.ApplicationCommandOptionChoice {
+	input = strings.ToLower(strings.TrimSpace(input))
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for i, item := range list.Items {
+		n := strconv.Itoa(i + 1)
+		if input != "" && !strings.HasPrefix(n, input) && !strings.Contains(strings.ToLower(item.Content), input) {
+			continue
+		}
+		statusIcon := "⬜"
+		if item.Status == "done" {
+			statusIcon = "✅"
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateRunes(fmt.Sprintf("%s. %s %s", n, statusIcon, item.Content), MaxChoiceNameLength),
+			Value: i + 1,
+		})
+		if len(choices) == MaxAutocompleteChoices {
+			break
+		}
+	}
+	return choices
+}
+
+// 入力中の名前に一致する名前つきのリストを、オートコンプリートの候補として返す
+func todoListChoices(names []string, input string) []*discordgo.ApplicationCommandOptionChoice {
+	input = strings.ToLower(strings.TrimSpace(input))
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range names {
+		if input != "" && !strings.Contains(strings.ToLower(name), input) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		if len(choices) == MaxAutocompleteChoices {
+			break
+		}
+	}
+	return choices
+}
+
+// /list のサブコマンドのオプションのうち、入力中のものの候補を返す
+// item の候補は、同時に指定されている list のリストから選ぶ
+func todoAutocompleteChoices(ctx context.Context, repo repository.TodoStore, channelID string, options []*discordgo.ApplicationCommandInteractionDataOption) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	name := ""
+	for _, opt := range options {
+		if opt.Focused {
+			focused = opt
+		} else if opt.Name == "list" {
+			name = strings.TrimSpace(fmt.Sprint(opt.Value))
+		}
+	}
+	if focused == nil {
+		return nil, nil
+	}
+
+	switch focused.Name {
+	case "list":
+		names, err := repo.ListTodoListNames(ctx, channelID)
+		if err != nil {
+			return nil, err
+		}
+		return todoListChoices(names, fmt.Sprint(focused.Value)), nil
+	case "item":
+		if name != "" && todo.ValidateListName(name) != nil {
+			return nil, nil
+		}
+		// 3 秒以内に応答する必要があるので、移行前のリストは移行せずに候補なしにする
+		list, err := repo.FindTodoList(ctx, channelID, name)
+		if err != nil {
+			return nil, err
+		}
+		return todoItemChoices(list, fmt.Sprint(focused.Value)), nil
+	}
+	return nil, nil
 }
 
 func ProcessTodoComponent(s *discordgo.Session, req *WorkerRequest) error {
@@ -111,100 +335,171 @@ func ProcessTodoComponent(s *discordgo.Session, req *WorkerRequest) error {
 		log.Printf("Repository init failed: %v", err)
 		return nil
 	}
+	return handleTodoComponent(s, req, repo)
+}
 
-	list, err := repo.GetTodoList(context.Background(), req.ChannelID)
-	if err != nil {
-		log.Printf("Failed to get list: %v", err)
-		return nil
+// ボタンの CustomID を解析した結果
+type todoAction struct {
+	Action string // "prev", "next" or "complete"
+	List   string // リストの名前 (チャンネルの既定のリストの場合は空)
+	Page   int
+	ItemID string // complete の場合のみ
+}
+
+// ボタンの CustomID を作る
+// 名前つきのリストの場合は末尾にリストの名前を付ける
+func todoCustomID(action, list string, page int, itemID string) string {
+	parts := []string{"todo", action, strconv.Itoa(page)}
+	if itemID != "" {
+		parts = append(parts, itemID)
 	}
+	if list != "" {
+		parts = append(parts, list)
+	}
+	return strings.Join(parts, ":")
+}
 
-	// CustomID format: "todo:action:page:extra"
-	parts := strings.Split(req.CustomID, ":")
+// CustomID ("todo:prev:page[:list]", "todo:next:page[:list]", "todo:complete:page:itemID[:list]") を解析する
+// リストの名前がない場合 (名前つきのリストに対応する前のメッセージを含む) はチャンネルの既定のリスト
+func parseTodoCustomID(customID string) (*todoAction, error) {
+	parts := strings.Split(customID, ":")
 	if len(parts) < 3 || parts[0] != "todo" {
+		return nil, fmt.Errorf("invalid custom id: %s", customID)
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 0 {
+		return nil, fmt.Errorf("invalid page in custom id: %s", customID)
+	}
+
+	action := &todoAction{Action: parts[1], Page: page}
+	rest := parts[3:]
+	switch action.Action {
+	case "prev", "next":
+	case "complete":
+		if len(rest) == 0 || rest[0] == "" {
+			return nil, fmt.Errorf("invalid custom id: %s", customID)
+		}
+		action.ItemID, rest = rest[0], rest[1:]
+	default:
+		return nil, fmt.Errorf("unknown action in custom id: %s", customID)
+	}
+	switch len(rest) {
+	case 0:
+	case 1:
+		if err := todo.ValidateListName(rest[0]); err != nil {
+			return nil, fmt.Errorf("invalid list name in custom id: %s", customID)
+		}
+		action.List = rest[0]
+	default:
+		return nil, fmt.Errorf("invalid custom id: %s", customID)
+	}
+	return action, nil
+}
+
+// 古いメッセージのボタンが削除済みのタスクを指している場合のエラー
+var errTodoItemRemoved = errors.New("todo item removed")
+
+func handleTodoComponent(s *discordgo.Session, req *WorkerRequest, repo repository.TodoStore) error {
+	action, err := parseTodoCustomID(req.CustomID)
+	if err != nil {
+		log.Printf("Ignoring component: %v", err)
 		return nil
 	}
 
-	action := parts[1]
-	var page int
-	fmt.Sscanf(parts[2], "%d", &page)
+	// ページ送りはリストを変更しないので保存しない
+	page := action.Page
+	if action.Action == "prev" || action.Action == "next" {
+		if action.Action == "prev" {
+			page--
+			if page < 0 {
+				page = 0
+			}
+		} else {
+			page++
+		}
+		// 表示するページのタスクだけを読み込む
+		p, err := repo.GetTodoPage(context.Background(), req.ChannelID, action.List, page, PageSize)
+		if err != nil {
+			log.Printf("Failed to get list: %v", err)
+			return nil
+		}
+		return updateListPage(s, req.ChannelID, p)
+	}
 
-	switch action {
-	case "prev":
-		page--
-		if page < 0 {
-			page = 0
+	var current *repository.TodoList
+	list, err := updateTodoList(context.Background(), repo, req.ChannelID, action.List, func(list *repository.TodoList) error {
+		current = list
+		i := list.IndexOf(action.ItemID)
+		if i < 0 {
+			return errTodoItemRemoved
 		}
-	case "next":
-		page++
-	case "complete":
-		if len(parts) >= 4 {
-			idxStr := parts[3]
-			var idx int
-			fmt.Sscanf(idxStr, "%d", &idx)
-
-			// Find item with ID = idxStr (Assuming ID is string representation of index initially, but keeping it simple)
-			// Wait, in handleAddItem, ID is "%d".
-			// We should iterate.
-			for i, item := range list.Items {
-				if item.ID == idxStr {
-					if list.Items[i].Status == "done" {
-						list.Items[i].Status = "open"
-					} else {
-						list.Items[i].Status = "done"
-					}
-					repo.SaveTodoList(context.Background(), list)
-					break
-				}
-			}
+		if list.Items[i].Status == "done" {
+			list.Items[i].Status = "open"
+		} else {
+			list.Items[i].Status = "done"
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errTodoItemRemoved):
+		// 何も変更せず、メッセージを最新の内容に更新する
+		if err := updateListMessage(s, req.ChannelID, current, page); err != nil {
+			return err
 		}
+		return sendEphemeralFollowup(s, req, "このタスクはすでに削除されています。")
+	case err != nil:
+		log.Printf("Failed to toggle todo item: %v", err)
+		return sendEphemeralFollowup(s, req, todoErrorMessage(err))
 	}
 
 	return updateListMessage(s, req.ChannelID, list, page)
 }
 
+// ボタンを押したユーザーだけに見えるメッセージを送る
+func sendEphemeralFollowup(s *discordgo.Session, req *WorkerRequest, content string) error {
+	_, err := s.WebhookExecute(req.ApplicationID, req.InteractionToken, false, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Printf("Failed to send followup: %v", err)
+	}
+	return err
+}
+
 func updateListMessage(s *discordgo.Session, channelID string, list *repository.TodoList, page int) error {
-	embed, components := renderTodoList(list, page)
+	return updateListPage(s, channelID, list.Page(page, PageSize))
+}
+
+// 読み込んだページでリストのメッセージを更新する
+func updateListPage(s *discordgo.Session, channelID string, page *repository.TodoPage) error {
+	embed, components := renderTodoList(page)
 
 	embeds := []*discordgo.MessageEmbed{embed}
 	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
 		Channel:    channelID,
-		ID:         list.MessageID,
+		ID:         page.MessageID,
 		Embeds:     &embeds,
 		Components: &components,
 	})
 	return err
 }
 
-func renderTodoList(list *repository.TodoList, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
-	totalItems := len(list.Items)
-	totalPages := (totalItems + PageSize - 1) / PageSize
-	if totalPages == 0 {
-		totalPages = 1
-	}
-
-	if page < 0 {
-		page = 0
-	}
-	if page >= totalPages {
-		page = totalPages - 1
-	}
-
-	start := page * PageSize
-	end := start + PageSize
-	if end > totalItems {
-		end = totalItems
-	}
+func renderTodoList(p *repository.TodoPage) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	page := p.Page
+	totalItems := p.TotalItems
+	totalPages := p.TotalPages(PageSize)
 
 	var description strings.Builder
 	var rowButtons []discordgo.MessageComponent
 
-	for i := start; i < end; i++ {
-		item := list.Items[i]
+	for n, item := range p.Items {
+		i := p.Offset + n
 		statusIcon := "⬜"
 		if item.Status == "done" {
 			statusIcon = "✅"
 		}
-		description.WriteString(fmt.Sprintf("%s %s\n", statusIcon, item.Content))
+		description.WriteString(fmt.Sprintf("%s %d. %s\n", statusIcon, i+1, item.Content))
 
 		// Number button
 		style := discordgo.SecondaryButton
@@ -212,10 +507,10 @@ func renderTodoList(list *repository.TodoList, page int) (*discordgo.MessageEmbe
 			style = discordgo.SuccessButton
 		}
 
-		// Button ID: todo:complete:page:itemID
+		// Button ID: todo:complete:page:itemID[:list]
 		btn := discordgo.Button{
 			Label:    fmt.Sprintf("%d", i+1), // Display 1-based index roughly? Or just number them 1-10 on the page? Issue says 1-10.
-			CustomID: fmt.Sprintf("todo:complete:%d:%s", page, item.ID),
+			CustomID: todoCustomID("complete", p.Name, page, item.ID),
 			Style:    style,
 		}
 		// Issue says: 1-10のリアクションは、該当するページのタスクの番号に対応する
@@ -231,8 +526,12 @@ func renderTodoList(list *repository.TodoList, page int) (*discordgo.MessageEmbe
 		description.WriteString("（タスクはありません）")
 	}
 
+	title := "TODO リスト"
+	if p.Name != "" {
+		title += ": " + p.Name
+	}
 	embed := &discordgo.MessageEmbed{
-		Title:       "TODO リスト",
+		Title:       title,
 		Description: description.String(),
 		Footer: &discordgo.MessageEmbedFooter{
 			Text: fmt.Sprintf("Page %d/%d (%d items)", page+1, totalPages, totalItems),
@@ -266,13 +565,13 @@ func renderTodoList(list *repository.TodoList, page int) (*discordgo.MessageEmbe
 	navComponents := []discordgo.MessageComponent{
 		discordgo.Button{
 			Label:    "⬅️ 前へ",
-			CustomID: fmt.Sprintf("todo:prev:%d", page),
+			CustomID: todoCustomID("prev", p.Name, page, ""),
 			Style:    discordgo.PrimaryButton,
 			Disabled: page == 0,
 		},
 		discordgo.Button{
 			Label:    "次へ ➡️",
-			CustomID: fmt.Sprintf("todo:next:%d", page),
+			CustomID: todoCustomID("next", p.Name, page, ""),
 			Style:    discordgo.PrimaryButton,
 			Disabled: page >= totalPages-1,
 		},
@@ -0,0 +1,609 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/yotu/wakaba/internal/repository"
+	"github.com/yotu/wakaba/internal/todo"
+)
+
+func newTestList(contents ...string) *repository.TodoList {
+	list := &repository.TodoList{ChannelID: "c", MessageID: "m"}
+	for i, c := range contents {
+		list.Items = append(list.Items, repository.TodoItem{ID: string(rune('a' + i)), Content: c, Status: "open"})
+	}
+	return list
+}
+
+func itemContents(list *repository.TodoList) []string {
+	var got []string
+	for _, item := range list.Items {
+		got = append(got, item.Content)
+	}
+	return got
+}
+
+func TestEditItem(t *testing.T) {
+	list := newTestList("買い物", "掃除")
+	old, err := editItem(list, 2, " 洗濯 ")
+	if err != nil {
+		t.Fatalf("editItem() error = %v", err)
+	}
+	if old != "掃除" || list.Items[1].Content != "洗濯" || list.Items[1].ID != "b" {
+		t.Errorf("editItem() = %q, items = %+v", old, list.Items)
+	}
+	if _, err := editItem(list, 3, "x"); err == nil {
+		t.Error("editItem(out of range) should fail")
+	}
+	if _, err := editItem(list, 1, " "); err == nil {
+		t.Error("editItem(blank) should fail")
+	}
+}
+
+func TestRemoveItem(t *testing.T) {
+	list := newTestList("a", "b", "c")
+	removed, err := removeItem(list, 2)
+	if err != nil {
+		t.Fatalf("removeItem() error = %v", err)
+	}
+	if removed.Content != "b" {
+		t.Errorf("removeItem() = %+v, want b", removed)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(itemContents(list), want) {
+		t.Errorf("items = %v, want %v", itemContents(list), want)
+	}
+	if _, err := removeItem(list, 0); err == nil {
+		t.Error("removeItem(0) should fail")
+	}
+	if _, err := removeItem(newTestList(), 1); err == nil {
+		t.Error("removeItem(empty list) should fail")
+	}
+}
+
+func TestMoveItem(t *testing.T) {
+	tests := []struct {
+		from, to int
+		want     []string
+	}{
+		{from: 1, to: 3, want: []string{"b", "c", "a", "d"}},
+		{from: 4, to: 1, want: []string{"d", "a", "b", "c"}},
+		{from: 2, to: 2, want: []string{"a", "b", "c", "d"}},
+		{from: 3, to: 4, want: []string{"a", "b", "d", "c"}},
+	}
+	for _, tt := range tests {
+		list := newTestList("a", "b", "c", "d")
+		if err := moveItem(list, tt.from, tt.to); err != nil {
+			t.Fatalf("moveItem(%d, %d) error = %v", tt.from, tt.to, err)
+		}
+		if got := itemContents(list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("moveItem(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+	if err := moveItem(newTestList("a", "b"), 1, 3); err == nil {
+		t.Error("moveItem(to out of range) should fail")
+	}
+}
+
+func TestTodoItemChoices(t *testing.T) {
+	list := newTestList("Write docs", "Review PR", "release notes")
+	list.Items[1].Status = "done"
+	for i := 3; i < 30; i++ {
+		list.Items = append(list.Items, repository.TodoItem{ID: "x", Content: "task", Status: "open"})
+	}
+
+	choices := todoItemChoices(list, "")
+	if len(choices) != MaxAutocompleteChoices {
+		t.Errorf("len(choices) = %d, want %d", len(choices), MaxAutocompleteChoices)
+	}
+	if choices[1].Name != "2. ✅ Review PR" || choices[1].Value != 2 {
+		t.Errorf("choices[1] = %+v", choices[1])
+	}
+
+	// 番号の先頭か内容で絞り込む
+	var got []any
+	for _, c := range todoItemChoices(list, "RE") {
+		got = append(got, c.Value)
+	}
+	if want := []any{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("choices(RE) = %v, want %v", got, want)
+	}
+	got = nil
+	for _, c := range todoItemChoices(list, "2") {
+		got = append(got, c.Value)
+	}
+	if want := []any{2, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29}; !reflect.DeepEqual(got, want) {
+		t.Errorf("choices(2) = %v, want %v", got, want)
+	}
+}
+
+// テスト用にメモリ上に TODO リストを保存する
+// TodoRepository と同じく、読み込んだ後に他から保存されていた場合は *repository.ConflictError を返す
+type memoryTodoStore struct {
+	mu    sync.Mutex
+	lists map[string]repository.TodoList
+	// 以前のテーブルにあるリスト。GetTodoList で lists に移行する
+	legacy map[string]repository.TodoList
+	saves  int
+	// 保存の直前に呼ばれる。別の利用者が同時に保存する状況を再現する
+	beforeSave func()
+}
+
+// lists のキー。名前つきのリストは "<channelID>#<name>"
+func memoryTodoKey(channelID, name string) string {
+	if name == "" {
+		return channelID
+	}
+	return channelID + "#" + name
+}
+
+func (m *memoryTodoStore) GetTodoList(ctx context.Context, channelID, name string) (*repository.TodoList, error) {
+	m.mu.Lock()
+	key := memoryTodoKey(channelID, name)
+	if legacy, ok := m.legacy[key]; ok {
+		if _, migrated := m.lists[key]; !migrated {
+			m.lists[key] = legacy
+		}
+	}
+	m.mu.Unlock()
+	return m.FindTodoList(ctx, channelID, name)
+}
+
+func (m *memoryTodoStore) FindTodoList(ctx context.Context, channelID, name string) (*repository.TodoList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, ok := m.lists[memoryTodoKey(channelID, name)]
+	if !ok {
+		return &repository.TodoList{ChannelID: channelID, Name: name, NextID: 1}, nil
+	}
+	list.Items = append([]repository.TodoItem(nil), list.Items...)
+	return &list, nil
+}
+
+func (m *memoryTodoStore) GetTodoPage(ctx context.Context, channelID, name string, page, size int) (*repository.TodoPage, error) {
+	list, err := m.GetTodoList(ctx, channelID, name)
+	if err != nil {
+		return nil, err
+	}
+	return list.Page(page, size), nil
+}
+
+func (m *memoryTodoStore) SaveTodoList(ctx context.Context, list *repository.TodoList) error {
+	if hook := m.beforeSave; hook != nil {
+		m.beforeSave = nil
+		hook()
+		m.beforeSave = hook
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryTodoKey(list.ChannelID, list.Name)
+	if current, ok := m.lists[key]; ok && current.Version != list.Version {
+		return &repository.ConflictError{ChannelID: list.ChannelID, Name: list.Name, Version: list.Version}
+	}
+	saved := *list
+	saved.Items = append([]repository.TodoItem(nil), list.Items...)
+	saved.Version++
+	m.lists[key] = saved
+	list.Version = saved.Version
+	m.saves++
+	return nil
+}
+
+func (m *memoryTodoStore) ListTodoListNames(ctx context.Context, channelID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := []string{}
+	for _, list := range m.lists {
+		if list.ChannelID == channelID && list.Name != "" {
+			names = append(names, list.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Discord API へのリクエストを記録する
+type recordedRequest struct {
+	Method, Path string
+	Body         map[string]any
+}
+
+func newRecordingSession(t *testing.T) (*discordgo.Session, *[]recordedRequest) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests []recordedRequest
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := url.Parse(ts.URL)
+	s.Client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	return s, &requests
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestParseTodoCustomID(t *testing.T) {
+	tests := []struct {
+		customID string
+		want     *todoAction
+	}{
+		{customID: "todo:next:0", want: &todoAction{Action: "next", Page: 0}},
+		{customID: "todo:complete:1:12", want: &todoAction{Action: "complete", Page: 1, ItemID: "12"}},
+		{customID: "todo:complete:1"},
+		{customID: "todo:complete:1:"},
+		{customID: "todo:next:-1"},
+		{customID: "todo:next:x"},
+		{customID: "todo:next:0:release-1.2", want: &todoAction{Action: "next", List: "release-1.2", Page: 0}},
+		{customID: "todo:complete:1:12:release-1.2", want: &todoAction{Action: "complete", List: "release-1.2", Page: 1, ItemID: "12"}},
+		{customID: "todo:next:0:"},
+		{customID: "todo:next:0:a#b"},
+		{customID: "todo:complete:1:12:release:extra"},
+		{customID: "todo:delete:0:1"},
+		{customID: "summary:next:0:abc"},
+	}
+	for _, tt := range tests {
+		got, err := parseTodoCustomID(tt.customID)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseTodoCustomID(%q) = %+v, want error", tt.customID, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTodoCustomID(%q) = %+v, %v, want %+v", tt.customID, got, err, tt.want)
+		}
+	}
+}
+
+func TestHandleTodoComponent(t *testing.T) {
+	newStore := func() *memoryTodoStore {
+		list := newTestList("a", "b", "c")
+		list.NextID = 4
+		list.Items[0].ID, list.Items[1].ID, list.Items[2].ID = "1", "2", "3"
+		return &memoryTodoStore{lists: map[string]repository.TodoList{"c": *list}}
+	}
+	req := func(customID string) *WorkerRequest {
+		return &WorkerRequest{Type: "component", ChannelID: "c", ApplicationID: "app", InteractionToken: "token", CustomID: customID}
+	}
+
+	t.Run("toggle", func(t *testing.T) {
+		store := newStore()
+		s, requests := newRecordingSession(t)
+		if err := handleTodoComponent(s, req("todo:complete:0:2"), store); err != nil {
+			t.Fatalf("handleTodoComponent() error = %v", err)
+		}
+		if got := store.lists["c"].Items[1].Status; got != "done" {
+			t.Errorf("status = %q, want done", got)
+		}
+		if len(*requests) != 1 || (*requests)[0].Method != http.MethodPatch || (*requests)[0].Path != "/api/v9/channels/c/messages/m" {
+			t.Errorf("requests = %+v, want a single message edit", *requests)
+		}
+	})
+
+	t.Run("removed item", func(t *testing.T) {
+		store := newStore()
+		list := store.lists["c"]
+		list.Items = list.Items[:1]
+		store.lists["c"] = list
+
+		s, requests := newRecordingSession(t)
+		if err := handleTodoComponent(s, req("todo:complete:0:2"), store); err != nil {
+			t.Fatalf("handleTodoComponent() error = %v", err)
+		}
+		if store.saves != 0 {
+			t.Errorf("saves = %d, want 0", store.saves)
+		}
+		// メッセージを最新にし、押した人にだけ通知する
+		if len(*requests) != 2 || (*requests)[1].Path != "/api/v9/webhooks/app/token" {
+			t.Fatalf("requests = %+v, want message edit and followup", *requests)
+		}
+		if flags, _ := (*requests)[1].Body["flags"].(float64); int(flags) != int(discordgo.MessageFlagsEphemeral) {
+			t.Errorf("followup flags = %v, want ephemeral", (*requests)[1].Body["flags"])
+		}
+	})
+
+	t.Run("stale id after re-add", func(t *testing.T) {
+		// 削除したタスクの ID は再利用しないので、古いボタンが新しいタスクを切り替えることはない
+		store := newStore()
+		list := store.lists["c"]
+		if _, err := removeItem(&list, 3); err != nil {
+			t.Fatal(err)
+		}
+		list.Items = append(list.Items, repository.TodoItem{ID: list.NewItemID(), Content: "d", Status: "open"})
+		store.lists["c"] = list
+
+		s, _ := newRecordingSession(t)
+		if err := handleTodoComponent(s, req("todo:complete:0:3"), store); err != nil {
+			t.Fatalf("handleTodoComponent() error = %v", err)
+		}
+		for _, item := range store.lists["c"].Items {
+			if item.Status != "open" {
+				t.Errorf("item %s status = %q, want open", item.ID, item.Status)
+			}
+		}
+	})
+
+	t.Run("invalid custom id", func(t *testing.T) {
+		store := newStore()
+		s, requests := newRecordingSession(t)
+		if err := handleTodoComponent(s, req("todo:complete:0"), store); err != nil {
+			t.Fatalf("handleTodoComponent() error = %v", err)
+		}
+		if store.saves != 0 || len(*requests) != 0 {
+			t.Errorf("saves = %d, requests = %+v, want nothing", store.saves, *requests)
+		}
+	})
+}
+
+// 別の利用者としてタスクを追加する
+func addAsOtherWriter(t *testing.T, store *memoryTodoStore, content string) {
+	t.Helper()
+	list, err := store.GetTodoList(context.Background(), "c", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Items = append(list.Items, repository.TodoItem{ID: list.NewItemID(), Content: content, Status: "open"})
+	if err := store.SaveTodoList(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateTodoListConflict(t *testing.T) {
+	addItem := func(content string) func(list *repository.TodoList) error {
+		return func(list *repository.TodoList) error {
+			list.Items = append(list.Items, repository.TodoItem{ID: list.NewItemID(), Content: content, Status: "open"})
+			return nil
+		}
+	}
+
+	t.Run("retry with reload", func(t *testing.T) {
+		store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+		conflicts := 1
+		store.beforeSave = func() {
+			if conflicts > 0 {
+				conflicts--
+				addAsOtherWriter(t, store, "other")
+			}
+		}
+
+		list, err := updateTodoList(context.Background(), store, "c", "", addItem("mine"))
+		if err != nil {
+			t.Fatalf("updateTodoList() error = %v", err)
+		}
+		// 他の利用者の変更を失わずに、読み込み直したリストに追加する
+		if want := []string{"other", "mine"}; !reflect.DeepEqual(itemContents(list), want) {
+			t.Errorf("items = %v, want %v", itemContents(list), want)
+		}
+		if got := store.lists["c"]; got.Version != 2 || !reflect.DeepEqual(itemContents(&got), []string{"other", "mine"}) {
+			t.Errorf("stored = %+v", got)
+		}
+		if ids := []string{list.Items[0].ID, list.Items[1].ID}; ids[0] == ids[1] {
+			t.Errorf("ids = %v, want unique", ids)
+		}
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+		store.beforeSave = func() { addAsOtherWriter(t, store, "other") }
+
+		_, err := updateTodoList(context.Background(), store, "c", "", addItem("mine"))
+		var conflict *repository.ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("updateTodoList() error = %v, want ConflictError", err)
+		}
+		if store.saves != TodoSaveRetries+1 {
+			t.Errorf("saves by other writer = %d, want %d", store.saves, TodoSaveRetries+1)
+		}
+		if msg := todoErrorMessage(err); msg == err.Error() {
+			t.Errorf("todoErrorMessage() = %q, want a user facing message", msg)
+		}
+	})
+
+	t.Run("mutate error", func(t *testing.T) {
+		store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+		_, err := updateTodoList(context.Background(), store, "c", "", func(list *repository.TodoList) error { return errNoTodoList })
+		if !errors.Is(err, errNoTodoList) || store.saves != 0 {
+			t.Errorf("updateTodoList() error = %v, saves = %d, want errNoTodoList and no save", err, store.saves)
+		}
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		// 同時に書き込むのが TodoSaveRetries+1 人までなら、誰の変更も失われない
+		store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+		writers := TodoSaveRetries + 1
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := updateTodoList(context.Background(), store, "c", "", addItem(strconv.Itoa(i)))
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("updateTodoList() error = %v", err)
+			}
+		}
+
+		got := store.lists["c"]
+		if len(got.Items) != writers || got.Version != writers {
+			t.Errorf("items = %v, version = %d, want %d items", itemContents(&got), got.Version, writers)
+		}
+		seen := map[string]bool{}
+		for _, item := range got.Items {
+			if seen[item.ID] {
+				t.Errorf("duplicate id %s in %+v", item.ID, got.Items)
+			}
+			seen[item.ID] = true
+		}
+	})
+}
+
+func TestHandleTodoComponentConcurrentToggle(t *testing.T) {
+	store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+	addAsOtherWriter(t, store, "a")
+	addAsOtherWriter(t, store, "b")
+
+	// 1 つ目のタスクを切り替えている間に、別の人が 2 つ目のタスクを切り替える
+	store.beforeSave = func() {
+		list, _ := store.GetTodoList(context.Background(), "c", "")
+		if list.Items[1].Status == "open" {
+			list.Items[1].Status = "done"
+			store.SaveTodoList(context.Background(), list)
+		}
+	}
+
+	s, _ := newRecordingSession(t)
+	req := &WorkerRequest{Type: "component", ChannelID: "c", ApplicationID: "app", InteractionToken: "token", CustomID: "todo:complete:0:1"}
+	if err := handleTodoComponent(s, req, store); err != nil {
+		t.Fatalf("handleTodoComponent() error = %v", err)
+	}
+
+	got := store.lists["c"]
+	if got.Items[0].Status != "done" || got.Items[1].Status != "done" {
+		t.Errorf("items = %+v, want both done", got.Items)
+	}
+}
+
+func TestTodoCustomIDRoundTrip(t *testing.T) {
+	name := strings.Repeat("あ", todo.MaxListNameLength)
+	id := todoCustomID("complete", name, 99, "1234567890")
+	if n := utf8.RuneCountInString(id); n > 100 {
+		t.Errorf("custom id %q has %d characters", id, n)
+	}
+	want := &todoAction{Action: "complete", List: name, Page: 99, ItemID: "1234567890"}
+	if got, err := parseTodoCustomID(id); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTodoCustomID(%q) = %+v, %v, want %+v", id, got, err, want)
+	}
+	if id := todoCustomID("next", "", 0, ""); id != "todo:next:0" {
+		t.Errorf("todoCustomID(default list) = %q", id)
+	}
+}
+
+func TestNamedTodoLists(t *testing.T) {
+	store := &memoryTodoStore{lists: map[string]repository.TodoList{}}
+	for _, name := range []string{"", "release-1.2", "backlog"} {
+		_, err := updateTodoList(context.Background(), store, "c", name, func(list *repository.TodoList) error {
+			list.MessageID = "m-" + name
+			list.Items = append(list.Items, repository.TodoItem{ID: list.NewItemID(), Content: "task " + name, Status: "open"})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("updateTodoList(%q) error = %v", name, err)
+		}
+	}
+
+	// ボタンは CustomID のリストだけを変更する
+	s, requests := newRecordingSession(t)
+	req := &WorkerRequest{Type: "component", ChannelID: "c", ApplicationID: "app", InteractionToken: "token", CustomID: "todo:complete:0:1:release-1.2"}
+	if err := handleTodoComponent(s, req, store); err != nil {
+		t.Fatalf("handleTodoComponent() error = %v", err)
+	}
+	for key, want := range map[string]string{"c": "open", "c#release-1.2": "done", "c#backlog": "open"} {
+		if got := store.lists[key].Items[0].Status; got != want {
+			t.Errorf("%s status = %q, want %q", key, got, want)
+		}
+	}
+	if len(*requests) != 1 || (*requests)[0].Path != "/api/v9/channels/c/messages/m-release-1.2" {
+		t.Fatalf("requests = %+v, want an edit of the release-1.2 message", *requests)
+	}
+	// 更新したメッセージのボタンにもリストの名前が入る
+	named := store.lists["c#release-1.2"]
+	embed, components := renderTodoList(named.Page(0, PageSize))
+	if embed.Title != "TODO リスト: release-1.2" {
+		t.Errorf("title = %q", embed.Title)
+	}
+	btn := components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if btn.CustomID != "todo:complete:0:1:release-1.2" {
+		t.Errorf("custom id = %q", btn.CustomID)
+	}
+
+	if err := noTodoListError("x"); errors.Is(err, errNoTodoList) || !strings.Contains(err.Error(), "name:x") {
+		t.Errorf("noTodoListError(x) = %v", err)
+	}
+}
+
+func TestTodoAutocompleteChoices(t *testing.T) {
+	store := &memoryTodoStore{lists: map[string]repository.TodoList{
+		"c":             *newTestList("default"),
+		"c#release-1.2": {ChannelID: "c", Name: "release-1.2", Items: []repository.TodoItem{{ID: "1", Content: "タグを打つ", Status: "open"}}},
+		"c#Backlog":     {ChannelID: "c", Name: "Backlog"},
+		"d#release-2.0": {ChannelID: "d", Name: "release-2.0"},
+	}, legacy: map[string]repository.TodoList{
+		"c#old": {ChannelID: "c", Name: "old", Items: []repository.TodoItem{{ID: "1", Content: "移行前", Status: "open"}}},
+	}}
+	option := func(name string, value any, focused bool) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Value: value, Focused: focused}
+	}
+	names := func(choices []*discordgo.ApplicationCommandOptionChoice) []string {
+		var got []string
+		for _, c := range choices {
+			got = append(got, c.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    []string
+	}{
+		{name: "all lists", options: []*discordgo.ApplicationCommandInteractionDataOption{option("list", "", true)}, want: []string{"Backlog", "release-1.2"}},
+		{name: "list by substring", options: []*discordgo.ApplicationCommandInteractionDataOption{option("list", "REL", true)}, want: []string{"release-1.2"}},
+		{name: "items of named list", options: []*discordgo.ApplicationCommandInteractionDataOption{option("item", "", true), option("list", "release-1.2", false)}, want: []string{"1. ⬜ タグを打つ"}},
+		{name: "items of default list", options: []*discordgo.ApplicationCommandInteractionDataOption{option("item", "", true)}, want: []string{"1. ⬜ default"}},
+		{name: "invalid list name", options: []*discordgo.ApplicationCommandInteractionDataOption{option("item", "", true), option("list", "a:b", false)}},
+		// 移行前のリストは移行せずに候補なしにする
+		{name: "unmigrated list", options: []*discordgo.ApplicationCommandInteractionDataOption{option("item", "", true), option("list", "old", false)}},
+		{name: "nothing focused", options: []*discordgo.ApplicationCommandInteractionDataOption{option("list", "x", false)}},
+	}
+	for _, tt := range tests {
+		choices, err := todoAutocompleteChoices(context.Background(), store, "c", tt.options)
+		if err != nil {
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		if got := names(choices); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: choices = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, ok := store.lists["c#old"]; ok {
+		t.Error("autocomplete migrated a legacy list")
+	}
+}
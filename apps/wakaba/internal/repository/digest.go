@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// 毎日決まった時刻に前日のまとめを投稿する設定
+type DigestSubscription struct {
+	ID              string `json:"id" dynamodbav:"id"` // "<channel_id>:<target_channel_id>"
+	GuildID         string `json:"guild_id" dynamodbav:"guild_id"`
+	ChannelID       string `json:"channel_id" dynamodbav:"channel_id"`               // まとめるチャンネル
+	TargetChannelID string `json:"target_channel_id" dynamodbav:"target_channel_id"` // まとめを投稿するチャンネル
+	Time            string `json:"time" dynamodbav:"time"`                           // 投稿する時刻 ("09:00")。サーバーのタイムゾーンで解釈する
+	ApplicationID   string `json:"application_id" dynamodbav:"application_id"`
+	CreatedBy       string `json:"created_by" dynamodbav:"created_by"`
+	LastPostedDate  string `json:"last_posted_date,omitempty" dynamodbav:"last_posted_date,omitempty"` // 最後に投稿した日 ("2006-01-02")
+}
+
+func DigestSubscriptionID(channelID, targetChannelID string) string {
+	return channelID + ":" + targetChannelID
+}
+
+type DigestRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewDigestRepository(ctx context.Context) (*DigestRepository, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DigestRepository{
+		client:    dynamodb.NewFromConfig(cfg),
+		tableName: getDigestTableName(),
+	}, nil
+}
+
+func getDigestTableName() string {
+	if t := os.Getenv("DIGEST_TABLE_NAME"); t != "" {
+		return t
+	}
+	return "wakaba-production-digest"
+}
+
+func (r *DigestRepository) SaveSubscription(ctx context.Context, sub *DigestSubscription) error {
+	item, err := attributevalue.MarshalMap(sub)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+// 設定を削除する。削除した場合は true を返す
+func (r *DigestRepository) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	out, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(out.Attributes) > 0, nil
+}
+
+// すべての設定を返す (件数は多くないのでテーブル全体を読む)
+func (r *DigestRepository) ListSubscriptions(ctx context.Context) ([]DigestSubscription, error) {
+	var subs []DigestSubscription
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName: aws.String(r.tableName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var page []DigestSubscription
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, err
+		}
+		subs = append(subs, page...)
+	}
+	return subs, nil
+}
+
+// 指定した日の投稿を予約する
+// すでに同じ日の投稿を予約済み (または設定が削除済み) の場合は false を返す
+// スケジュールの実行が重なっても 1 日に 1 回だけ投稿するために条件付きで更新する
+func (r *DigestRepository) ClaimDate(ctx context.Context, id, date string) (bool, error) {
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET last_posted_date = :date"),
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(last_posted_date) OR last_posted_date <> :date)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":date": &types.AttributeValueMemberS{Value: date},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ClaimDate で予約した投稿を取り消し、次のスケジュールの実行で投稿し直せるようにする
+// 予約した後に別の日付で予約し直されていた場合は何もしない
+func (r *DigestRepository) ReleaseDate(ctx context.Context, id, date, previous string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("REMOVE last_posted_date"),
+		ConditionExpression: aws.String("last_posted_date = :date"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":date": &types.AttributeValueMemberS{Value: date},
+		},
+	}
+	if previous != "" {
+		input.UpdateExpression = aws.String("SET last_posted_date = :previous")
+		input.ExpressionAttributeValues[":previous"] = &types.AttributeValueMemberS{Value: previous}
+	}
+	_, err := r.client.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	return err
+}
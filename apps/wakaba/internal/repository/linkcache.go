@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/yotu/wakaba/internal/util"
+)
+
+// キャッシュされたリンク先のメタデータ
+type LinkMetadata struct {
+	URL       string            `json:"url" dynamodbav:"url"` // Normalized URL
+	Metadata  util.PageMetadata `json:"metadata" dynamodbav:"metadata"`
+	Failed    bool              `json:"failed" dynamodbav:"failed"` // Negative cache entry
+	Error     string            `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	FetchedAt int64             `json:"fetched_at" dynamodbav:"fetched_at"`
+	ExpiresAt int64             `json:"expires_at" dynamodbav:"expires_at"` // DynamoDB TTL (unix seconds)
+}
+
+// リンク先のメタデータのキャッシュ
+// 期限切れの判定は呼び出し側で ExpiresAt を見て行う
+type LinkCache interface {
+	// キャッシュがない場合は nil を返す
+	GetLinkMetadata(ctx context.Context, url string) (*LinkMetadata, error)
+	SaveLinkMetadata(ctx context.Context, entry *LinkMetadata) error
+}
+
+type LinkCacheRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewLinkCacheRepository(ctx context.Context) (*LinkCacheRepository, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkCacheRepository{
+		client:    dynamodb.NewFromConfig(cfg),
+		tableName: getLinkCacheTableName(),
+	}, nil
+}
+
+func getLinkCacheTableName() string {
+	if t := os.Getenv("LINK_CACHE_TABLE_NAME"); t != "" {
+		return t
+	}
+	return "wakaba-production-link-cache"
+}
+
+func (r *LinkCacheRepository) GetLinkMetadata(ctx context.Context, url string) (*LinkMetadata, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"url": &types.AttributeValueMemberS{Value: url},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	var entry LinkMetadata
+	if err := attributevalue.UnmarshalMap(out.Item, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (r *LinkCacheRepository) SaveLinkMetadata(ctx context.Context, entry *LinkMetadata) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+// テスト用のメモリ上のキャッシュ
+type MemoryLinkCache struct {
+	mu      sync.Mutex
+	entries map[string]LinkMetadata
+}
+
+func NewMemoryLinkCache() *MemoryLinkCache {
+	return &MemoryLinkCache{entries: map[string]LinkMetadata{}}
+}
+
+func (c *MemoryLinkCache) GetLinkMetadata(ctx context.Context, url string) (*LinkMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (c *MemoryLinkCache) SaveLinkMetadata(ctx context.Context, entry *LinkMetadata) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[entry.URL] = *entry
+	return nil
+}
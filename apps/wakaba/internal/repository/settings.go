@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ギルドまたはユーザーごとの設定
+type Settings struct {
+	ID       string `json:"id" dynamodbav:"id"`             // "guild:<guild_id>" or "user:<user_id>"
+	Timezone string `json:"timezone" dynamodbav:"timezone"` // IANA timezone name (e.g. "Asia/Tokyo")
+}
+
+func GuildSettingsID(guildID string) string {
+	return "guild:" + guildID
+}
+
+func UserSettingsID(userID string) string {
+	return "user:" + userID
+}
+
+type SettingsRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewSettingsRepository(ctx context.Context) (*SettingsRepository, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SettingsRepository{
+		client:    dynamodb.NewFromConfig(cfg),
+		tableName: getSettingsTableName(),
+	}, nil
+}
+
+func getSettingsTableName() string {
+	if t := os.Getenv("SETTINGS_TABLE_NAME"); t != "" {
+		return t
+	}
+	return "wakaba-production-settings"
+}
+
+// 設定を取得する。未設定の場合は空の設定を返す
+func (r *SettingsRepository) GetSettings(ctx context.Context, id string) (*Settings, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Item == nil {
+		return &Settings{ID: id}, nil
+	}
+
+	var settings Settings
+	if err := attributevalue.UnmarshalMap(out.Item, &settings); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (r *SettingsRepository) SaveSettings(ctx context.Context, settings *Settings) error {
+	item, err := attributevalue.MarshalMap(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// まとめ結果を保持する期間（ページ送りはこの期間だけ可能）
+const SummaryTTL = 7 * 24 * time.Hour
+
+// ページ送りのために保存する /summarize の結果
+// 1 行の上限 (400 KB) を超えないよう、各ページは別の行に保存する
+type Summary struct {
+	ID        string   `json:"id" dynamodbav:"id"` // Interaction ID of the /summarize command
+	Title     string   `json:"title" dynamodbav:"title"`
+	Footer    string   `json:"footer" dynamodbav:"footer"`
+	Pages     []string `json:"pages" dynamodbav:"pages,omitempty"` // Rendered embed descriptions (以前の形式の行にだけ保存されている)
+	PageCount int      `json:"page_count" dynamodbav:"page_count"` // ページの行の数
+	ExpiresAt int64    `json:"expires_at" dynamodbav:"expires_at"` // DynamoDB TTL (unix seconds)
+}
+
+// 1 ページ分の行
+type summaryPageRow struct {
+	ID        string `dynamodbav:"id"` // summaryPageID
+	Body      string `dynamodbav:"body"`
+	ExpiresAt int64  `dynamodbav:"expires_at"`
+}
+
+// ページの行の ID。Interaction ID は数字だけなので、まとめ結果の ID とは重ならない
+func summaryPageID(id string, page int) string {
+	return fmt.Sprintf("%s#page#%d", id, page)
+}
+
+type SummaryRepository struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+func NewSummaryRepository(ctx context.Context) (*SummaryRepository, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SummaryRepository{
+		client:    dynamodb.NewFromConfig(cfg),
+		tableName: getSummaryTableName(),
+	}, nil
+}
+
+func getSummaryTableName() string {
+	if t := os.Getenv("SUMMARY_TABLE_NAME"); t != "" {
+		return t
+	}
+	return "wakaba-production-summary"
+}
+
+// まとめ結果の page ページ目 (0 始まり) を取得する。存在しない（期限切れを含む）場合は nil を返す
+// 返す Summary の Pages は PageCount の長さで、範囲内に収めた page ページ目だけが入っている
+func (r *SummaryRepository) GetSummary(ctx context.Context, id string, page int) (*Summary, error) {
+	var summary Summary
+	found, err := r.getItem(ctx, id, &summary)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	// TTL による削除は遅れることがあるので、期限切れはここでも弾く
+	if summary.ExpiresAt != 0 && time.Now().Unix() > summary.ExpiresAt {
+		return nil, nil
+	}
+
+	// 以前の形式の行はすべてのページを持っている
+	if len(summary.Pages) > 0 || summary.PageCount == 0 {
+		summary.PageCount = len(summary.Pages)
+		return &summary, nil
+	}
+
+	page = max(0, min(page, summary.PageCount-1))
+	var row summaryPageRow
+	found, err = r.getItem(ctx, summaryPageID(id, page), &row)
+	if err != nil || !found {
+		return nil, err
+	}
+	summary.Pages = make([]string, summary.PageCount)
+	summary.Pages[page] = row.Body
+	return &summary, nil
+}
+
+// id の行を読み込んで v に入れる。行がない場合は false を返す
+func (r *SummaryRepository) getItem(ctx context.Context, id string, v any) (bool, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if out.Item == nil {
+		return false, nil
+	}
+	return true, attributevalue.UnmarshalMap(out.Item, v)
+}
+
+// ページを 1 行ずつ保存してから、タイトルなどの行を保存する
+// タイトルなどの行が最後なので、途中で失敗しても読み込み側から欠けたページは見えない
+func (r *SummaryRepository) SaveSummary(ctx context.Context, summary *Summary) error {
+	if summary.ExpiresAt == 0 {
+		summary.ExpiresAt = time.Now().Add(SummaryTTL).Unix()
+	}
+
+	for i, body := range summary.Pages {
+		row := summaryPageRow{ID: summaryPageID(summary.ID, i), Body: body, ExpiresAt: summary.ExpiresAt}
+		if err := r.putItem(ctx, row); err != nil {
+			return fmt.Errorf("failed to save summary page %d: %w", i, err)
+		}
+	}
+
+	header := summaryHeader(summary)
+	return r.putItem(ctx, &header)
+}
+
+// ページを除いたタイトルなどの行
+func summaryHeader(summary *Summary) Summary {
+	header := *summary
+	header.Pages = nil
+	header.PageCount = len(summary.Pages)
+	return header
+}
+
+func (r *SummaryRepository) putItem(ctx context.Context, v any) error {
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	return err
+}
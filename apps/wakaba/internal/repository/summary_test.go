@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestSummaryHeaderAttributes(t *testing.T) {
+	summary := &Summary{ID: "123", Title: "title", Pages: []string{strings.Repeat("a", 4000), strings.Repeat("b", 4000)}, ExpiresAt: 1}
+	row, err := attributevalue.MarshalMap(summaryHeader(summary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// ページはタイトルなどの行に含めない
+	if want := []string{"expires_at", "footer", "id", "page_count", "title"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("attributes = %v, want %v", keys, want)
+	}
+	var header Summary
+	if err := attributevalue.UnmarshalMap(row, &header); err != nil || header.PageCount != 2 {
+		t.Errorf("PageCount = %d, %v, want 2", header.PageCount, err)
+	}
+	if len(summary.Pages) != 2 {
+		t.Errorf("summaryHeader modified the summary: %d pages", len(summary.Pages))
+	}
+	if got := summaryPageID("123", 1); got != "123#page#1" {
+		t.Errorf("summaryPageID() = %q, want 123#page#1", got)
+	}
+}
@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -14,33 +19,188 @@ import (
 type TodoItem struct {
 	ID      string `json:"id" dynamodbav:"id"`
 	Content string `json:"content" dynamodbav:"content"`
-	Status  string `json:"status" dynamodbav:"status"` // "open", "done"
+	Status  string `json:"status" dynamodbav:"status"`                 // "open", "done"
+	Rank    string `json:"rank,omitempty" dynamodbav:"rank,omitempty"` // 並び順 (文字列として比較する)。保存時に割り当てる
 }
 
+// チャンネルの TODO リスト
+// テーブルにはリストの情報 (sk = "meta") とタスク (sk = "item#<id>") を別の行として保存する
+// 名前つきのリストは channel_id を "<channel_id>#<name>" とした別のパーティションに保存し、
+// チャンネルのパーティションにはリストの名前の一覧 (sk = "list#<name>") を保存する
+// Items の dynamodbav タグは、リスト全体を 1 行に保存していた頃の形式を読むためのもの
 type TodoList struct {
 	ChannelID string     `json:"channel_id" dynamodbav:"channel_id"`
+	Name      string     `json:"name,omitempty" dynamodbav:"-"` // 空の場合はチャンネルの既定のリスト
 	Items     []TodoItem `json:"items" dynamodbav:"items"`
 	MessageID string     `json:"message_id" dynamodbav:"message_id"` // Pinned message ID
+	NextID    int        `json:"next_id" dynamodbav:"next_id"`       // 次に追加するタスクの ID (削除しても再利用しない)
+	Version   int        `json:"version" dynamodbav:"version"`       // 保存するたびに増える。読み込んだ後に他から保存されたかの判定に使う
+
+	// 読み込んだ時点のタスク。保存時に変更のあった行だけを書き込むために使う
+	loaded map[string]TodoItem
+}
+
+// 読み込んだ後に他から保存されていたため、リストを保存できなかったことを示すエラー
+type ConflictError struct {
+	ChannelID string
+	Name      string
+	Version   int // 保存しようとしたリストの読み込み時のバージョン
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("todo list %s was modified concurrently (version %d)", todoPartitionKey(e.ChannelID, e.Name), e.Version)
+}
+
+// 新しいタスクの ID を払い出す
+func (l *TodoList) NewItemID() string {
+	if l.NextID < 1 {
+		l.NextID = 1
+	}
+	id := strconv.Itoa(l.NextID)
+	l.NextID++
+	return id
+}
+
+// page ページ目 (0 始まり) のタスクを返す。範囲外の場合は最初か最後のページ
+func (l *TodoList) Page(page, size int) *TodoPage {
+	p := &TodoPage{Name: l.Name, MessageID: l.MessageID, TotalItems: len(l.Items)}
+	p.Page = clampPage(page, p.TotalPages(size))
+	p.Offset = p.Page * size
+	end := min(p.Offset+size, len(l.Items))
+	p.Items = l.Items[p.Offset:end]
+	return p
+}
+
+// ページ単位で読み込んだ TODO リスト
+type TodoPage struct {
+	Name       string // リストの名前
+	MessageID  string
+	Page       int        // 0 始まり
+	Offset     int        // Items[0] のリスト全体での位置 (0 始まり)
+	Items      []TodoItem // このページのタスク
+	TotalItems int
+}
+
+// 1 ページあたり size 件のときのページ数 (タスクがない場合も 1)
+func (p *TodoPage) TotalPages(size int) int {
+	return max(1, (p.TotalItems+size-1)/size)
+}
+
+func clampPage(page, totalPages int) int {
+	return max(0, min(page, totalPages-1))
+}
+
+// ID が id のタスクの位置を返す。ない場合は -1
+func (l *TodoList) IndexOf(id string) int {
+	for i, item := range l.Items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// NextID がない (len(Items)+1 を ID にしていた頃の) リストの ID を重複しないように振り直す
+// 最初に現れた ID はそのまま残し、古いメッセージのボタンが同じタスクを指すようにする
+// 振り直した場合は true を返す
+func (l *TodoList) MigrateItemIDs() bool {
+	if l.NextID > 0 {
+		return false
+	}
+
+	maxID := 0
+	for _, item := range l.Items {
+		if n, err := strconv.Atoi(item.ID); err == nil && n > maxID {
+			maxID = n
+		}
+	}
+	l.NextID = maxID + 1
+
+	seen := map[string]bool{}
+	for i, item := range l.Items {
+		n, err := strconv.Atoi(item.ID)
+		if err != nil || n < 1 || seen[item.ID] {
+			l.Items[i].ID = l.NewItemID()
+		}
+		seen[l.Items[i].ID] = true
+	}
+	return true
+}
+
+// TODO リストの保存先
+type TodoStore interface {
+	// name が空の場合はチャンネルの既定のリスト。リストがない場合は空のリストを返す
+	GetTodoList(ctx context.Context, channelID, name string) (*TodoList, error)
+	// page ページ目 (0 始まり) のタスクだけを読み込む。範囲外の場合は最初か最後のページ
+	GetTodoPage(ctx context.Context, channelID, name string, page, size int) (*TodoPage, error)
+	// GetTodoList と同じだが、以前のテーブルからの移行をせず書き込みを一切しない
+	// 移行前のリストは空のリストになる
+	FindTodoList(ctx context.Context, channelID, name string) (*TodoList, error)
+	SaveTodoList(ctx context.Context, list *TodoList) error
+	// チャンネルにある名前つきのリストの名前を名前順に返す
+	ListTodoListNames(ctx context.Context, channelID string) ([]string, error)
+}
+
+const (
+	todoMetaKey    = "meta"
+	todoItemPrefix = "item#"
+	todoNamePrefix = "list#"
+	// Rank の順にタスクを読むためのローカルセカンダリインデックス
+	todoRankIndex = "rank-index"
+	// 1 回のトランザクションで書き込める行の数
+	maxTransactItems = 100
+)
+
+// リストの情報を保存する行
+type todoMetaRow struct {
+	ChannelID string `dynamodbav:"channel_id"`
+	SK        string `dynamodbav:"sk"` // "meta"
+	MessageID string `dynamodbav:"message_id"`
+	NextID    int    `dynamodbav:"next_id"`
+	Version   int    `dynamodbav:"version"`
+	ItemCount int    `dynamodbav:"item_count"`
+}
+
+// チャンネルのパーティションに保存する、名前つきのリストの行
+type todoNameRow struct {
+	ChannelID string `dynamodbav:"channel_id"`
+	SK        string `dynamodbav:"sk"` // "list#<name>"
+	Name      string `dynamodbav:"name"`
+}
+
+// タスクを 1 件ずつ保存する行
+type todoItemRow struct {
+	ChannelID string `dynamodbav:"channel_id"`
+	SK        string `dynamodbav:"sk"` // "item#<id>"
+	TodoItem
 }
 
 type TodoRepository struct {
 	client    *dynamodb.Client
 	tableName string
+	// リスト全体を 1 行に保存していた頃のテーブル。空でない場合、まだ移行していないリストを読むときに移行する
+	legacyTableName string
 }
 
 func NewTodoRepository(ctx context.Context) (*TodoRepository, error) {
+	repo, err := NewTodoRepositoryForTable(ctx, getTableName())
+	if err != nil {
+		return nil, err
+	}
+	repo.legacyTableName = os.Getenv("LEGACY_TODO_TABLE_NAME")
+	return repo, nil
+}
+
+// 指定したテーブルを使う (移行用のコマンドなどで使う)
+func NewTodoRepositoryForTable(ctx context.Context, tableName string) (*TodoRepository, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TodoRepository{
-		client: dynamodb.NewFromConfig(cfg),
-		// Note: The table name should ideally be passed via environment variable or config.
-		// Since we changed Terraform to use "${var.project_name}-todo", and we plan to change project_name.
-		// For now, let's look for env var or default to "wakaba-production-todo" ?
-		// Better: use os.Getenv("DYNAMODB_TABLE_NAME")
-		tableName: getTableName(),
+		client:    dynamodb.NewFromConfig(cfg),
+		tableName: tableName,
 	}, nil
 }
 
@@ -48,43 +208,300 @@ func getTableName() string {
 	if t := os.Getenv("DYNAMODB_TABLE_NAME"); t != "" {
 		return t
 	}
-	return "wakaba-production-todo" // updated default
+	return "wakaba-production-todo-items"
 }
 
-func (r *TodoRepository) GetTodoList(ctx context.Context, channelID string) (*TodoList, error) {
-	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(r.tableName),
-		Key: map[string]types.AttributeValue{
-			"channel_id": &types.AttributeValueMemberS{Value: channelID},
+func todoKey(channelID, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"channel_id": &types.AttributeValueMemberS{Value: channelID},
+		"sk":         &types.AttributeValueMemberS{Value: sk},
+	}
+}
+
+// リストの行を保存するパーティションのキー
+// チャンネル ID は数字だけなので、名前つきのリストのキーがチャンネルのキーと重なることはない
+func todoPartitionKey(channelID, name string) string {
+	if name == "" {
+		return channelID
+	}
+	return channelID + "#" + name
+}
+
+// リストの情報とすべてのタスクを読み込む
+// リストの情報の行がなく、以前のテーブルにリストがある場合は、移行してから読み込む
+func (r *TodoRepository) GetTodoList(ctx context.Context, channelID, name string) (*TodoList, error) {
+	list, found, err := r.queryTodoList(ctx, channelID, name)
+	if err != nil || found {
+		return list, err
+	}
+	imported, err := r.importLegacyTodoList(ctx, channelID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate todo list %s: %w", channelID, err)
+	}
+	if !imported {
+		return list, nil
+	}
+	list, _, err = r.queryTodoList(ctx, channelID, name)
+	return list, err
+}
+
+// リストの情報とすべてのタスクを読み込む。移行はしない
+// オートコンプリートのように応答の時間が限られていて、書き込みをしてはいけない場面で使う
+func (r *TodoRepository) FindTodoList(ctx context.Context, channelID, name string) (*TodoList, error) {
+	list, _, err := r.queryTodoList(ctx, channelID, name)
+	return list, err
+}
+
+// リストの情報とすべてのタスクを読み込み、リストの情報の行があったかどうかを返す
+func (r *TodoRepository) queryTodoList(ctx context.Context, channelID, name string) (*TodoList, bool, error) {
+	found := false
+	list := &TodoList{ChannelID: channelID, Name: name, Items: []TodoItem{}, NextID: 1}
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("channel_id = :channel_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":channel_id": &types.AttributeValueMemberS{Value: todoPartitionKey(channelID, name)},
 		},
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, row := range out.Items {
+			sk, _ := row["sk"].(*types.AttributeValueMemberS)
+			if sk == nil {
+				continue
+			}
+			if sk.Value == todoMetaKey {
+				var meta todoMetaRow
+				if err := attributevalue.UnmarshalMap(row, &meta); err != nil {
+					return nil, false, err
+				}
+				list.MessageID, list.NextID, list.Version = meta.MessageID, meta.NextID, meta.Version
+				found = true
+				continue
+			}
+			// 既定のリストのパーティションには名前つきのリストの一覧の行もある
+			if !strings.HasPrefix(sk.Value, todoItemPrefix) {
+				continue
+			}
+			var item todoItemRow
+			if err := attributevalue.UnmarshalMap(row, &item); err != nil {
+				return nil, false, err
+			}
+			list.Items = append(list.Items, item.TodoItem)
+		}
+	}
+
+	sort.SliceStable(list.Items, func(i, j int) bool { return list.Items[i].Rank < list.Items[j].Rank })
+	list.loaded = snapshotItems(list.Items)
+	return list, found, nil
+}
+
+// page ページ目のタスクだけを Rank の順に読み込む
+// ページの位置を指定して読むことはできないので、前のページはキーだけを読んで読み飛ばす
+func (r *TodoRepository) GetTodoPage(ctx context.Context, channelID, name string, page, size int) (*TodoPage, error) {
+	partition := todoPartitionKey(channelID, name)
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            todoKey(partition, todoMetaKey),
+		ConsistentRead: aws.Bool(true),
 	})
 	if err != nil {
 		return nil, err
 	}
-
 	if out.Item == nil {
-		return &TodoList{ChannelID: channelID, Items: []TodoItem{}}, nil
+		// まだ移行していないリストの場合があるので、リスト全体を読み込む
+		list, err := r.GetTodoList(ctx, channelID, name)
+		if err != nil {
+			return nil, err
+		}
+		return list.Page(page, size), nil
 	}
-
-	var list TodoList
-	if err := attributevalue.UnmarshalMap(out.Item, &list); err != nil {
+	var meta todoMetaRow
+	if err := attributevalue.UnmarshalMap(out.Item, &meta); err != nil {
 		return nil, err
 	}
 
-	return &list, nil
+	p := &TodoPage{Name: name, MessageID: meta.MessageID, TotalItems: meta.ItemCount, Items: []TodoItem{}}
+	p.Page = clampPage(page, p.TotalPages(size))
+	p.Offset = p.Page * size
+	if p.TotalItems == 0 {
+		return p, nil
+	}
+
+	query := func(startKey map[string]types.AttributeValue, keysOnly bool) (*dynamodb.QueryOutput, error) {
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableName),
+			IndexName:              aws.String(todoRankIndex),
+			KeyConditionExpression: aws.String("channel_id = :channel_id"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":channel_id": &types.AttributeValueMemberS{Value: partition},
+			},
+			ExclusiveStartKey: startKey,
+			Limit:             aws.Int32(int32(size)),
+			ConsistentRead:    aws.Bool(true),
+		}
+		if keysOnly {
+			input.ProjectionExpression = aws.String("channel_id, sk, #rank")
+			input.ExpressionAttributeNames = map[string]string{"#rank": "rank"}
+		}
+		return r.client.Query(ctx, input)
+	}
+
+	var startKey map[string]types.AttributeValue
+	for i := 0; i < p.Page; i++ {
+		out, err := query(startKey, true)
+		if err != nil {
+			return nil, err
+		}
+		if startKey = out.LastEvaluatedKey; startKey == nil {
+			// item_count より実際のタスクが少ない場合
+			return p, nil
+		}
+	}
+	out2, err := query(startKey, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range out2.Items {
+		var item todoItemRow
+		if err := attributevalue.UnmarshalMap(row, &item); err != nil {
+			return nil, err
+		}
+		p.Items = append(p.Items, item.TodoItem)
+	}
+	return p, nil
 }
 
+// リストを保存する
+// 並び順に合わせて Rank を割り当て、読み込んだ時点から変わったタスクの行だけを書き込む
+// 読み込んだ後に他から保存されていた場合は保存せずに *ConflictError を返す
+// 保存できた場合は list.Version を進める
 func (r *TodoRepository) SaveTodoList(ctx context.Context, list *TodoList) error {
-	item, err := attributevalue.MarshalMap(list)
+	assignRanks(list.Items)
+	partition := todoPartitionKey(list.ChannelID, list.Name)
+
+	meta, err := attributevalue.MarshalMap(&todoMetaRow{
+		ChannelID: partition,
+		SK:        todoMetaKey,
+		MessageID: list.MessageID,
+		NextID:    list.NextID,
+		Version:   list.Version + 1,
+		ItemCount: len(list.Items),
+	})
+	if err != nil {
+		return err
+	}
+	// リストの情報の行のバージョンで、読み込んだ後に他から保存されていないかを確かめる
+	writes := []types.TransactWriteItem{{
+		Put: &types.Put{
+			TableName:           aws.String(r.tableName),
+			Item:                meta,
+			ConditionExpression: aws.String("attribute_not_exists(version) OR version = :version"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.Itoa(list.Version)},
+			},
+		},
+	}}
+
+	// 名前つきのリストを作るときは、チャンネルのリストの一覧にも追加する
+	if list.Name != "" && list.Version == 0 {
+		row, err := attributevalue.MarshalMap(&todoNameRow{ChannelID: list.ChannelID, SK: todoNamePrefix + list.Name, Name: list.Name})
+		if err != nil {
+			return err
+		}
+		writes = append(writes, types.TransactWriteItem{
+			Put: &types.Put{TableName: aws.String(r.tableName), Item: row},
+		})
+	}
+
+	changed, removed := list.changes()
+	for _, item := range changed {
+		row, err := attributevalue.MarshalMap(&todoItemRow{ChannelID: partition, SK: todoItemPrefix + item.ID, TodoItem: item})
+		if err != nil {
+			return err
+		}
+		writes = append(writes, types.TransactWriteItem{
+			Put: &types.Put{TableName: aws.String(r.tableName), Item: row},
+		})
+	}
+	for _, id := range removed {
+		writes = append(writes, types.TransactWriteItem{
+			Delete: &types.Delete{TableName: aws.String(r.tableName), Key: todoKey(partition, todoItemPrefix+id)},
+		})
+	}
+	if len(writes) > maxTransactItems {
+		return fmt.Errorf("too many changes to todo list %s at once: %d", partition, len(writes)-1)
+	}
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+		aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+		return &ConflictError{ChannelID: list.ChannelID, Name: list.Name, Version: list.Version}
+	}
 	if err != nil {
 		return err
 	}
 
-	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(r.tableName),
-		Item:      item,
+	list.Version++
+	list.loaded = snapshotItems(list.Items)
+	return nil
+}
+
+// チャンネルの名前つきのリストの一覧を読み込む
+func (r *TodoRepository) ListTodoListNames(ctx context.Context, channelID string) ([]string, error) {
+	names := []string{}
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("channel_id = :channel_id AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":channel_id": &types.AttributeValueMemberS{Value: channelID},
+			":prefix":     &types.AttributeValueMemberS{Value: todoNamePrefix},
+		},
 	})
-	return err
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range out.Items {
+			var name todoNameRow
+			if err := attributevalue.UnmarshalMap(row, &name); err != nil {
+				return nil, err
+			}
+			names = append(names, name.Name)
+		}
+	}
+	return names, nil
 }
 
-// Helper to avoid circular dependency in imports if needed, but for now sticking to strict types
+// 読み込んだ時点から追加・変更されたタスクと、削除されたタスクの ID を返す
+func (l *TodoList) changes() (changed []TodoItem, removed []string) {
+	current := make(map[string]bool, len(l.Items))
+	for _, item := range l.Items {
+		current[item.ID] = true
+		if old, ok := l.loaded[item.ID]; ok && old == item {
+			continue
+		}
+		changed = append(changed, item)
+	}
+	for id := range l.loaded {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+func snapshotItems(items []TodoItem) map[string]TodoItem {
+	loaded := make(map[string]TodoItem, len(items))
+	for _, item := range items {
+		loaded[item.ID] = item
+	}
+	return loaded
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestMigrateItemIDs(t *testing.T) {
+	// len(Items)+1 で ID を振っていた頃に削除と追加を繰り返したリスト
+	list := &TodoList{Items: []TodoItem{{ID: "1"}, {ID: "3"}, {ID: "3"}, {ID: ""}, {ID: "2"}}}
+	if !list.MigrateItemIDs() {
+		t.Fatal("MigrateItemIDs() = false, want true")
+	}
+
+	var got []string
+	for _, item := range list.Items {
+		got = append(got, item.ID)
+	}
+	if want := []string{"1", "3", "4", "5", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+	if list.NextID != 6 || list.NewItemID() != "6" {
+		t.Errorf("NextID = %d, want 6", list.NextID)
+	}
+
+	// 移行済みのリストは変更しない
+	if list.MigrateItemIDs() {
+		t.Error("MigrateItemIDs() on migrated list = true, want false")
+	}
+}
+
+func TestTodoListPage(t *testing.T) {
+	list := &TodoList{MessageID: "m"}
+	for i := 0; i < 23; i++ {
+		list.Items = append(list.Items, TodoItem{ID: strconv.Itoa(i + 1)})
+	}
+
+	tests := []struct {
+		page, wantPage, wantOffset, wantItems int
+	}{
+		{page: 0, wantPage: 0, wantOffset: 0, wantItems: 10},
+		{page: 2, wantPage: 2, wantOffset: 20, wantItems: 3},
+		{page: 5, wantPage: 2, wantOffset: 20, wantItems: 3},
+		{page: -1, wantPage: 0, wantOffset: 0, wantItems: 10},
+	}
+	for _, tt := range tests {
+		p := list.Page(tt.page, 10)
+		if p.Page != tt.wantPage || p.Offset != tt.wantOffset || len(p.Items) != tt.wantItems || p.TotalItems != 23 || p.MessageID != "m" {
+			t.Errorf("Page(%d) = %+v", tt.page, p)
+		}
+		if p.TotalPages(10) != 3 {
+			t.Errorf("TotalPages() = %d, want 3", p.TotalPages(10))
+		}
+	}
+
+	empty := (&TodoList{}).Page(3, 10)
+	if empty.Page != 0 || len(empty.Items) != 0 || empty.TotalPages(10) != 1 {
+		t.Errorf("empty Page() = %+v", empty)
+	}
+}
+
+func TestTodoListChanges(t *testing.T) {
+	list := &TodoList{Items: []TodoItem{
+		{ID: "1", Content: "a", Status: "open"},
+		{ID: "2", Content: "b", Status: "open"},
+		{ID: "3", Content: "c", Status: "open"},
+	}}
+	assignRanks(list.Items)
+	list.loaded = snapshotItems(list.Items)
+
+	// 切り替え・削除・追加・移動
+	list.Items[0].Status = "done"
+	list.Items = append(list.Items[:1], list.Items[2:]...)
+	list.Items = append(list.Items, TodoItem{ID: "4", Content: "d", Status: "open"})
+	list.Items = append([]TodoItem{list.Items[1]}, list.Items[0], list.Items[2])
+	assignRanks(list.Items)
+
+	changed, removed := list.changes()
+	var ids []string
+	for _, item := range changed {
+		ids = append(ids, item.ID)
+	}
+	// 3 は Rank を、1 は状態を書き換え、4 は追加する
+	if want := []string{"3", "1", "4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("changed = %v, want %v", ids, want)
+	}
+	if changed[1].Rank != "0000000001i" {
+		t.Errorf("rank of 1 = %q, want unchanged", changed[1].Rank)
+	}
+	if want := []string{"2"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	// 変更がなければ何も書き込まない
+	list.loaded = snapshotItems(list.Items)
+	if changed, removed := list.changes(); len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("changes() = %v, %v, want none", changed, removed)
+	}
+}
+
+func TestTodoItemRowAttributes(t *testing.T) {
+	row, err := attributevalue.MarshalMap(&todoItemRow{ChannelID: "c", SK: "item#1", TodoItem: TodoItem{ID: "1", Content: "a", Status: "open", Rank: "0000000001i"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if want := []string{"channel_id", "content", "id", "rank", "sk", "status"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("attributes = %v, want %v", keys, want)
+	}
+}
+
+func TestTodoPartitionKey(t *testing.T) {
+	if got := todoPartitionKey("123", ""); got != "123" {
+		t.Errorf("todoPartitionKey(default) = %q, want 123", got)
+	}
+	if got := todoPartitionKey("123", "release-1.2"); got != "123#release-1.2" {
+		t.Errorf("todoPartitionKey(named) = %q, want 123#release-1.2", got)
+	}
+	// 名前つきのリストの一覧の行はタスクとして読まれない
+	if strings.HasPrefix(todoNamePrefix+"item", todoItemPrefix) || todoNamePrefix+"meta" == todoMetaKey {
+		t.Errorf("prefix %q overlaps item or meta keys", todoNamePrefix)
+	}
+}
+
+func TestImportConditionFailed(t *testing.T) {
+	reasons := func(codes ...string) *types.TransactionCanceledException {
+		e := &types.TransactionCanceledException{}
+		for _, c := range codes {
+			e.CancellationReasons = append(e.CancellationReasons, types.CancellationReason{Code: aws.String(c)})
+		}
+		return e
+	}
+	// すでにある行があった場合だけ移行済みとみなし、スロットリングなどはエラーにする
+	if !importConditionFailed(reasons("None", "ConditionalCheckFailed")) {
+		t.Error("ConditionalCheckFailed should be treated as already imported")
+	}
+	if importConditionFailed(reasons("ThrottlingError", "None")) {
+		t.Error("ThrottlingError should not be treated as already imported")
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// リスト全体を 1 行に保存していた頃のテーブルからすべてのリストを読み、fn を呼ぶ
+// 重複した ID は MigrateItemIDs で振り直す
+func (r *TodoRepository) ScanLegacyTodoLists(ctx context.Context, legacyTableName string, fn func(list *TodoList) error) error {
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName: aws.String(legacyTableName),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, row := range out.Items {
+			var list TodoList
+			if err := attributevalue.UnmarshalMap(row, &list); err != nil {
+				return err
+			}
+			list.MigrateItemIDs()
+			if err := fn(&list); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 以前のテーブルにチャンネルの既定のリストがあれば移行する。移行した場合は true を返す
+// 名前つきのリストは以前のテーブルにはないので何もしない
+func (r *TodoRepository) importLegacyTodoList(ctx context.Context, channelID, name string) (bool, error) {
+	if r.legacyTableName == "" || name != "" {
+		return false, nil
+	}
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.legacyTableName),
+		Key:            map[string]types.AttributeValue{"channel_id": &types.AttributeValueMemberS{Value: channelID}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	if out.Item == nil {
+		return false, nil
+	}
+	var list TodoList
+	if err := attributevalue.UnmarshalMap(out.Item, &list); err != nil {
+		return false, err
+	}
+	list.MigrateItemIDs()
+	if _, err := r.ImportTodoList(ctx, &list); err != nil {
+		return false, err
+	}
+	// 同時に別の処理が移行した場合も、読み込み直せば移行後のリストが読める
+	return true, nil
+}
+
+// 古い形式のリストをタスクごとの行に分けて書き込む
+// 書き込み先にすでにリストがある場合は上書きせずに false を返す
+// リストを読み込むときに移行する (importLegacyTodoList) ので、リストの情報の行があれば移行済みとみなせる
+func (r *TodoRepository) ImportTodoList(ctx context.Context, list *TodoList) (bool, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.tableName),
+		Key:            todoKey(list.ChannelID, todoMetaKey),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	if out.Item != nil {
+		return false, nil
+	}
+
+	assignRanks(list.Items)
+	meta, err := attributevalue.MarshalMap(&todoMetaRow{
+		ChannelID: list.ChannelID,
+		SK:        todoMetaKey,
+		MessageID: list.MessageID,
+		NextID:    list.NextID,
+		Version:   list.Version + 1,
+		ItemCount: len(list.Items),
+	})
+	if err != nil {
+		return false, err
+	}
+	var rows []map[string]types.AttributeValue
+	for _, item := range list.Items {
+		row, err := attributevalue.MarshalMap(&todoItemRow{ChannelID: list.ChannelID, SK: todoItemPrefix + item.ID, TodoItem: item})
+		if err != nil {
+			return false, err
+		}
+		rows = append(rows, row)
+	}
+
+	// 同時に移行した別の処理や、移行後に変更されたタスクを上書きしないよう、ない行だけを書き込む
+	// 1 回のトランザクションに収まる場合はまとめて書き込み、リストの情報の行があれば何も書き込まない
+	if len(rows)+1 <= maxTransactItems {
+		writes := []types.TransactWriteItem{{Put: newImportPut(r.tableName, meta)}}
+		for _, row := range rows {
+			writes = append(writes, types.TransactWriteItem{Put: newImportPut(r.tableName, row)})
+		}
+		_, err := r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) && importConditionFailed(canceled) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// 収まらない場合はタスクの行を先に書き、最後にリストの情報の行を書く (途中で失敗しても再実行できる)
+	for _, row := range rows {
+		if _, err := r.putIfNotExists(ctx, row); err != nil {
+			return false, err
+		}
+	}
+	return r.putIfNotExists(ctx, meta)
+}
+
+// トランザクションが、すでにある行があったために取り消されたか
+func importConditionFailed(canceled *types.TransactionCanceledException) bool {
+	for _, reason := range canceled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// 行がない場合だけ書き込む Put
+func newImportPut(tableName string, row map[string]types.AttributeValue) *types.Put {
+	return &types.Put{
+		TableName:           aws.String(tableName),
+		Item:                row,
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	}
+}
+
+// 行がない場合だけ書き込み、書き込んだかどうかを返す
+func (r *TodoRepository) putIfNotExists(ctx context.Context, row map[string]types.AttributeValue) (bool, error) {
+	put := newImportPut(r.tableName, row)
+	_, err := r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           put.TableName,
+		Item:                put.Item,
+		ConditionExpression: put.ConditionExpression,
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
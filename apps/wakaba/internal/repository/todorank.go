@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// タスクの並び順を表す Rank は、文字列として比較した順序がリストの順序になる
+// 末尾に追加するときは先頭 rankHeadWidth 文字の 36 進数を 1 つ進め、
+// 間に挿入するときは前後の Rank の中間の文字列を作るので、他のタスクの Rank を書き換えずに並べ替えられる
+const (
+	rankDigits    = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rankHeadWidth = 10
+)
+
+// prev と next の間に並ぶ Rank を返す
+// prev が空の場合は先頭、next が空の場合は末尾に並ぶ Rank を返す
+func rankBetween(prev, next string) string {
+	if next == "" {
+		head, _ := strconv.ParseUint(padRank(prev), 36, 64)
+		s := strconv.FormatUint(head+1, 36)
+		return strings.Repeat("0", rankHeadWidth-len(s)) + s + "i"
+	}
+	return rankMidpoint(prev, next)
+}
+
+// Rank の先頭 rankHeadWidth 文字を返す (短い場合は "0" で埋める)
+func padRank(rank string) string {
+	if len(rank) >= rankHeadWidth {
+		return rank[:rankHeadWidth]
+	}
+	return rank + strings.Repeat("0", rankHeadWidth-len(rank))
+}
+
+// a < x < b となる文字列 x を返す (b が空の場合は上限なし)
+// a と b は末尾が "0" でないこと。返す文字列の末尾も "0" にならない
+func rankMidpoint(a, b string) string {
+	if b != "" {
+		// 共通の接頭辞はそのまま残す (a が短い場合は "0" が続くものとみなす)
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + rankMidpoint(rest, b[n:])
+		}
+	}
+
+	da := 0
+	if a != "" {
+		da = strings.IndexByte(rankDigits, a[0])
+	}
+	db := len(rankDigits)
+	if b != "" {
+		db = strings.IndexByte(rankDigits, b[0])
+	}
+	if db-da > 1 {
+		return string(rankDigits[(da+db)/2])
+	}
+	// 1 文字目が隣り合う場合
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if a != "" {
+		rest = a[1:]
+	}
+	return string(rankDigits[da]) + rankMidpoint(rest, "")
+}
+
+func rankDigitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return rankDigits[0]
+}
+
+// items の並び順に合うように Rank を割り当てる
+// 並び順が保たれている最大の範囲 (Rank の最長増加部分列) の Rank はそのまま残し、
+// 追加・移動したタスクにだけ新しい Rank を割り当てる。割り当てたタスクの数を返す
+func assignRanks(items []TodoItem) int {
+	keep := longestIncreasingRanks(items)
+
+	assigned := 0
+	prev := ""
+	for i := range items {
+		if keep[i] {
+			prev = items[i].Rank
+			continue
+		}
+		next := ""
+		for j := i + 1; j < len(items); j++ {
+			if keep[j] {
+				next = items[j].Rank
+				break
+			}
+		}
+		items[i].Rank = rankBetween(prev, next)
+		prev = items[i].Rank
+		assigned++
+	}
+	return assigned
+}
+
+// Rank が狭義単調増加になる最長の部分列に含まれるタスクの位置を返す
+func longestIncreasingRanks(items []TodoItem) []bool {
+	// tails[k] は長さ k+1 の増加部分列の末尾の位置、parent はその 1 つ前の位置
+	var tails []int
+	parent := make([]int, len(items))
+	for i, item := range items {
+		parent[i] = -1
+		if item.Rank == "" {
+			continue
+		}
+		k := sort.Search(len(tails), func(k int) bool { return items[tails[k]].Rank >= item.Rank })
+		if k > 0 {
+			parent[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	keep := make([]bool, len(items))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = parent[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       string
+	}{
+		{prev: "", next: "", want: "0000000001i"},
+		{prev: "0000000001i", next: "", want: "0000000002i"},
+		{prev: "000000000zi", next: "", want: "0000000010i"},
+		{prev: "0000000002", next: "", want: "0000000003i"},
+		{prev: "0000000001i", next: "0000000002i", want: "0000000002"},
+		{prev: "", next: "0000000001i", want: "0000000001"},
+		{prev: "", next: "0000000001", want: "0000000000i"},
+		{prev: "0000000001i", next: "0000000001j", want: "0000000001ii"},
+	}
+	for _, tt := range tests {
+		got := rankBetween(tt.prev, tt.next)
+		if got != tt.want {
+			t.Errorf("rankBetween(%q, %q) = %q, want %q", tt.prev, tt.next, got, tt.want)
+		}
+		if got <= tt.prev || (tt.next != "" && got >= tt.next) {
+			t.Errorf("rankBetween(%q, %q) = %q is out of order", tt.prev, tt.next, got)
+		}
+	}
+}
+
+func TestAssignRanks(t *testing.T) {
+	items := func(ranks ...string) []TodoItem {
+		var list []TodoItem
+		for i, r := range ranks {
+			list = append(list, TodoItem{ID: strconv.Itoa(i + 1), Rank: r})
+		}
+		return list
+	}
+
+	// 末尾への追加
+	list := items("0000000001i", "0000000002i", "")
+	if n := assignRanks(list); n != 1 || list[2].Rank != "0000000003i" {
+		t.Errorf("append: assigned %d, ranks %+v", n, list)
+	}
+
+	// 移動したタスクだけを書き換える
+	list = items("0000000001i", "0000000002i", "0000000003i", "0000000004i")
+	list = append([]TodoItem{list[3]}, list[:3]...)
+	if n := assignRanks(list); n != 1 || list[0].Rank != "0000000001" || list[1].Rank != "0000000001i" {
+		t.Errorf("move to top: assigned %d, ranks %+v", n, list)
+	}
+
+	// ランダムな操作を繰り返しても順序が保たれる
+	rng := rand.New(rand.NewSource(1))
+	list = nil
+	for step := 0; step < 2000; step++ {
+		switch op := rng.Intn(4); {
+		case op == 0 || len(list) < 2:
+			list = append(list, TodoItem{})
+		case op == 1:
+			i := rng.Intn(len(list) + 1)
+			list = append(list[:i], append([]TodoItem{{}}, list[i:]...)...)
+		case op == 2:
+			i, j := rng.Intn(len(list)), rng.Intn(len(list))
+			item := list[i]
+			list = append(list[:i], list[i+1:]...)
+			list = append(list[:j], append([]TodoItem{item}, list[j:]...)...)
+		default:
+			i := rng.Intn(len(list))
+			list = append(list[:i], list[i+1:]...)
+		}
+		assignRanks(list)
+		for i, item := range list {
+			if strings.HasSuffix(item.Rank, "0") {
+				t.Fatalf("step %d: rank %q ends with 0", step, item.Rank)
+			}
+			if i > 0 && list[i-1].Rank >= item.Rank {
+				t.Fatalf("step %d: ranks out of order: %q >= %q", step, list[i-1].Rank, item.Rank)
+			}
+		}
+	}
+	for _, item := range list {
+		if len(item.Rank) > 40 {
+			t.Errorf("rank %q is too long", item.Rank)
+		}
+	}
+}
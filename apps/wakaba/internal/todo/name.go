@@ -0,0 +1,23 @@
+// TODO リストの名前の規則
+// コマンドの登録 (cmd/register) と処理 (handler) の両方で使うので、依存のない小さなパッケージにしている
+package todo
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// リストの名前の最大文字数 (ボタンの CustomID に含めるため、100 文字の上限に収まるようにする)
+const MaxListNameLength = 32
+
+// リストの名前に使える文字。CustomID やテーブルのキーの区切りに使う ":" と "#" は含まない
+var listNamePattern = regexp.MustCompile(`^[\p{L}\p{N}._-]+$`)
+
+// リストの名前として使えるか確かめる
+func ValidateListName(name string) error {
+	if utf8.RuneCountInString(name) > MaxListNameLength || !listNamePattern.MatchString(name) {
+		return fmt.Errorf("リストの名前は %d 文字以内の文字・数字・「.」「_」「-」で指定してください", MaxListNameLength)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateListName(t *testing.T) {
+	for _, name := range []string{"release-1.2", "リリース_2", strings.Repeat("あ", MaxListNameLength)} {
+		if err := ValidateListName(name); err != nil {
+			t.Errorf("ValidateListName(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "a:b", "a#b", "a b", strings.Repeat("a", MaxListNameLength+1)} {
+		if err := ValidateListName(name); err == nil {
+			t.Errorf("ValidateListName(%q) should fail", name)
+		}
+	}
+}
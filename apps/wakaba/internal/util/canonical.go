@@ -0,0 +1,151 @@
+package util
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// 共有時に付加される、ページの内容に関係しないクエリパラメータ
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"gbraid":  true,
+	"wbraid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+	"ref_url": true,
+	"si":      true, // YouTube / Spotify share id
+	"feature": true, // YouTube share source
+}
+
+// 同じコンテンツを指す別名のホスト
+// "m." で始まるホストが PC 版と同じページとは限らないので、モバイル版のホストもここに列挙する
+var mirrorHosts = map[string]string{
+	"m.youtube.com":       "youtube.com",
+	"m.twitch.tv":         "twitch.tv",
+	"m.imdb.com":          "imdb.com",
+	"m.soundcloud.com":    "soundcloud.com",
+	"m.tiktok.com":        "tiktok.com",
+	"mobile.twitter.com":  "x.com",
+	"twitter.com":         "x.com",
+	"vxtwitter.com":       "x.com",
+	"fxtwitter.com":       "x.com",
+	"fixupx.com":          "x.com",
+	"mobile.x.com":        "x.com",
+	"m.facebook.com":      "facebook.com",
+	"old.reddit.com":      "reddit.com",
+	"new.reddit.com":      "reddit.com",
+	"amp.theguardian.com": "theguardian.com",
+}
+
+// 同じページを指す URL が同じ文字列になるように正規化する
+//   - スキーム・ホストの小文字化、デフォルトポートの除去
+//   - 先頭の "www." の除去と、既知のミラーホスト (youtu.be やモバイル版など) の置き換え
+//   - utm_* などのトラッキング用パラメータの除去と、残りのパラメータの並べ替え
+//   - 末尾のスラッシュとフラグメントの除去 ("#!" や "#/" で始まるものは残す)
+//
+// 解析できない URL はそのまま返す
+func CanonicalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	query := u.Query()
+
+	// youtu.be/ID は youtube.com/watch?v=ID と同じ
+	if host == "youtu.be" {
+		if id := strings.Trim(u.Path, "/"); id != "" {
+			query.Set("v", id)
+		}
+		host, u.Path, u.RawPath = "youtube.com", "/watch", ""
+	}
+
+	if mirror, ok := mirrorHosts[host]; ok {
+		host = mirror
+	} else if trimmed, ok := strings.CutPrefix(host, "www."); ok && strings.Contains(trimmed, ".") {
+		host = trimmed
+	}
+
+	// IPv6 アドレスは角括弧で囲む
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = encodeSortedQuery(query)
+	u.ForceQuery = false
+
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+		if u.Path == "" {
+			u.Path, u.RawPath = "/", ""
+		}
+	}
+	if !strings.HasPrefix(u.Fragment, "!") && !strings.HasPrefix(u.Fragment, "/") {
+		u.Fragment, u.RawFragment = "", ""
+	}
+
+	if u.Path == "/" && u.RawQuery == "" && u.Fragment == "" {
+		u.Path = ""
+	}
+
+	return u.String()
+}
+
+// キーと値で並べ替えてクエリ文字列にする
+func encodeSortedQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			if sb.Len() > 0 {
+				sb.WriteByte('&')
+			}
+			sb.WriteString(url.QueryEscape(k))
+			if v != "" {
+				sb.WriteByte('=')
+				sb.WriteString(url.QueryEscape(v))
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,116 @@
+package util
+
+import "testing"
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "already canonical",
+			url:  "https://example.com/article/1",
+			want: "https://example.com/article/1",
+		},
+		{
+			name: "utm parameters",
+			url:  "https://example.com/article/1?utm_source=twitter&utm_medium=social&UTM_Campaign=x",
+			want: "https://example.com/article/1",
+		},
+		{
+			name: "fbclid and si with other params kept and sorted",
+			url:  "https://example.com/search?q=go&fbclid=abc&page=2&si=xyz",
+			want: "https://example.com/search?page=2&q=go",
+		},
+		{
+			name: "trailing slash",
+			url:  "https://example.com/article/1/",
+			want: "https://example.com/article/1",
+		},
+		{
+			name: "root trailing slash",
+			url:  "https://example.com/",
+			want: "https://example.com",
+		},
+		{
+			name: "host case and default port",
+			url:  "HTTPS://Example.COM:443/Path",
+			want: "https://example.com/Path",
+		},
+		{
+			name: "non-default port kept",
+			url:  "http://example.com:8080/a",
+			want: "http://example.com:8080/a",
+		},
+		{
+			name: "www prefix",
+			url:  "https://www.example.com/a",
+			want: "https://example.com/a",
+		},
+		{
+			// "m." で始まっていてもモバイル版の別名とは限らない
+			name: "unknown mobile prefix",
+			url:  "https://m.example.com/a",
+			want: "https://m.example.com/a",
+		},
+		{
+			name: "known mobile host",
+			url:  "https://m.twitch.tv/videos/1",
+			want: "https://twitch.tv/videos/1",
+		},
+		{
+			name: "ipv6 with port",
+			url:  "http://[2001:DB8::1]:8080/a",
+			want: "http://[2001:db8::1]:8080/a",
+		},
+		{
+			name: "ipv6 with default port",
+			url:  "https://[2001:db8::1]:443/a",
+			want: "https://[2001:db8::1]/a",
+		},
+		{
+			name: "youtu.be short link",
+			url:  "https://youtu.be/dQw4w9WgXcQ?si=share123",
+			want: "https://youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name: "youtube mobile with feature",
+			url:  "https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share",
+			want: "https://youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name: "youtube www with timestamp",
+			url:  "https://www.youtube.com/watch?t=42&v=dQw4w9WgXcQ",
+			want: "https://youtube.com/watch?t=42&v=dQw4w9WgXcQ",
+		},
+		{
+			name: "twitter to x",
+			url:  "https://twitter.com/user/status/1?s=20",
+			want: "https://x.com/user/status/1?s=20",
+		},
+		{
+			name: "fragment removed",
+			url:  "https://example.com/a#comments",
+			want: "https://example.com/a",
+		},
+		{
+			name: "hash routing kept",
+			url:  "https://example.com/#/app/page",
+			want: "https://example.com/#/app/page",
+		},
+		{
+			name: "not a url",
+			url:  "not a url",
+			want: "not a url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanonicalizeURL(tt.url); got != tt.want {
+				t.Errorf("CanonicalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
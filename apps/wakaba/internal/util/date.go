@@ -2,56 +2,218 @@ package util
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// 一度に指定できる期間の最大日数
+const MaxRangeDays = 31
+
+// タイムゾーンが設定されていない場合に使うデフォルトのタイムゾーン (JST)
+var DefaultLocation = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+var (
+	// -3d, 3日前
+	daysAgoRegex = regexp.MustCompile(`^(?:-(\d+)d|(\d+)日前)$`)
+	// 10/17, 2026/10/17, 2026-10-17
+	slashDateRegex = regexp.MustCompile(`^(?:(\d{4})[/-])?(\d{1,2})[/-](\d{1,2})$`)
+	// 10月17日, 2026年10月17日
+	kanjiDateRegex = regexp.MustCompile(`^(?:(\d{4})年)?(\d{1,2})月(\d{1,2})日$`)
+)
+
+// 全角数字・記号を半角に揃える
+var fullWidthReplacer = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+	"５", "5", "６", "6", "７", "7", "８", "8", "９", "9",
+	"／", "/", "－", "-", "　", " ",
+)
+
+// 範囲指定の区切り文字 ("-" は日付の区切りと衝突するため最後に試す)
+var rangeSeparators = []string{"~", "〜", "..", "-"}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "日曜": time.Sunday, "日曜日": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "月曜": time.Monday, "月曜日": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday, "火曜": time.Tuesday, "火曜日": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday, "水曜": time.Wednesday, "水曜日": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday, "木曜": time.Thursday, "木曜日": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "金曜": time.Friday, "金曜日": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "土曜": time.Saturday, "土曜日": time.Saturday,
+}
+
 // 日付文字列を解析して、開始日時と終了日時を返す
+// 日付は now のタイムゾーンを基準に解釈する
 // MMDD 形式で渡された場合、現在年の日付を返す
 // YYYYMMDD 形式で渡された場合、指定年の日付を返す
+// 以下の表現も受け付ける
+//   - today / 今日, yesterday / 昨日, 一昨日
+//   - -3d / 3日前
+//   - this week / 今週, last week / 先週 (月曜始まりの 1 週間)
+//   - 曜日名 (monday, mon, 月曜日 など。今日以前で直近のその曜日)
+//   - 10/17, 2026/10/17, 2026-10-17, 10月17日, 2026年10月17日
+//
+// "1014-1017" や "昨日~今日" のように区切られた場合、その期間を返す
 func ParseDateInput(input string, now time.Time) (time.Time, time.Time, error) {
-	var year, month, day int
-	var err error
+	input = normalizeDateInput(input)
 
-	// JST location
-	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	start, end, err := parseExpr(input, now)
+	if err == nil {
+		return start, end, nil
+	}
 
-	if len(input) == 4 {
-		// MMDD format
-		year = now.In(jst).Year()
-		month, err = strconv.Atoi(input[:2])
-		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("invalid month: %w", err)
+	// 単一の表現として解釈できなければ、範囲指定として解釈を試みる
+	for _, sep := range rangeSeparators {
+		for i := 0; i < len(input); i++ {
+			if !strings.HasPrefix(input[i:], sep) {
+				continue
+			}
+			from := strings.TrimSpace(input[:i])
+			to := strings.TrimSpace(input[i+len(sep):])
+			if _, _, ferr := parseExpr(from, now); ferr != nil {
+				continue
+			}
+			if _, _, terr := parseExpr(to, now); terr != nil {
+				continue
+			}
+			return ParseDateRange(from, to, now)
 		}
-		day, err = strconv.Atoi(input[2:])
+	}
+
+	return time.Time{}, time.Time{}, err
+}
+
+// 開始日と終了日の文字列を解析して、期間の開始日時と終了日時を返す
+// 終了日が空の場合は、今日までの期間を返す
+func ParseDateRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start, _, err := parseExpr(normalizeDateInput(from), now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+
+	var end time.Time
+	if to == "" {
+		_, end, _ = dayBounds(now.In(start.Location()))
+	} else {
+		_, end, err = parseExpr(normalizeDateInput(to), now)
 		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("invalid day: %w", err)
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
 		}
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end date %s is before start date %s", end.Format("2006-01-02"), start.Format("2006-01-02"))
+	}
+
+	if days := calendarDays(start, end); days > MaxRangeDays {
+		return time.Time{}, time.Time{}, fmt.Errorf("range too long: %d days (max %d)", days, MaxRangeDays)
+	}
+
+	return start, end, nil
+}
+
+func normalizeDateInput(input string) string {
+	input = fullWidthReplacer.Replace(input)
+	return strings.ToLower(strings.TrimSpace(input))
+}
+
+// 単一の日付表現を解析して、その表現が指す期間を返す
+func parseExpr(input string, now time.Time) (time.Time, time.Time, error) {
+	today := now
+
+	switch input {
+	case "today", "今日", "きょう":
+		return dayBounds(today)
+	case "yesterday", "昨日", "きのう":
+		return dayBounds(today.AddDate(0, 0, -1))
+	case "一昨日", "おととい":
+		return dayBounds(today.AddDate(0, 0, -2))
+	case "this week", "今週":
+		start, _, _ := weekBounds(today)
+		_, end, _ := dayBounds(today)
+		return start, end, nil
+	case "last week", "先週":
+		return weekBounds(today.AddDate(0, 0, -7))
+	}
+
+	if wd, ok := weekdayNames[input]; ok {
+		diff := (int(today.Weekday()) - int(wd) + 7) % 7
+		return dayBounds(today.AddDate(0, 0, -diff))
+	}
+
+	if m := daysAgoRegex.FindStringSubmatch(input); m != nil {
+		n, _ := strconv.Atoi(m[1] + m[2])
+		return dayBounds(today.AddDate(0, 0, -n))
+	}
+
+	if m := slashDateRegex.FindStringSubmatch(input); m != nil {
+		return parseYMD(m[1], m[2], m[3], today)
+	}
+
+	if m := kanjiDateRegex.FindStringSubmatch(input); m != nil {
+		return parseYMD(m[1], m[2], m[3], today)
+	}
+
+	if len(input) == 4 {
+		// MMDD format
+		return parseYMD("", input[:2], input[2:], today)
 	} else if len(input) == 8 {
 		// YYYYMMDD format
-		year, err = strconv.Atoi(input[:4])
+		return parseYMD(input[:4], input[4:6], input[6:], today)
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid format, expected MMDD, YYYYMMDD, MM/DD, YYYY-MM-DD, today, yesterday, -Nd, last week or weekday name")
+}
+
+// 年・月・日の文字列から 1 日分の期間を返す（年が空の場合は現在年）
+func parseYMD(yearStr, monthStr, dayStr string, today time.Time) (time.Time, time.Time, error) {
+	year := today.Year()
+	if yearStr != "" {
+		y, err := strconv.Atoi(yearStr)
 		if err != nil {
 			return time.Time{}, time.Time{}, fmt.Errorf("invalid year: %w", err)
 		}
-		month, err = strconv.Atoi(input[4:6])
-		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("invalid month: %w", err)
-		}
-		day, err = strconv.Atoi(input[6:])
-		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("invalid day: %w", err)
-		}
-
-	} else {
-		return time.Time{}, time.Time{}, fmt.Errorf("invalid format, expected MMDD or YYYYMMDD")
+		year = y
+	}
+	month, err := strconv.Atoi(monthStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month: %w", err)
+	}
+	day, err := strconv.Atoi(dayStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid day: %w", err)
 	}
 
-	startOfDay := time.Date(year, time.Month(month), day, 0, 0, 0, 0, jst)
+	startOfDay := time.Date(year, time.Month(month), day, 0, 0, 0, 0, today.Location())
 	if startOfDay.Year() != year || startOfDay.Month() != time.Month(month) || startOfDay.Day() != day {
 		return time.Time{}, time.Time{}, fmt.Errorf("invalid date: %04d-%02d-%02d", year, month, day)
 	}
 
-	endOfDay := time.Date(year, time.Month(month), day, 23, 59, 59, 999999999, jst)
+	return dayBounds(startOfDay)
+}
+
+// 指定日時を含む 1 日の開始日時と終了日時を返す
+func dayBounds(t time.Time) (time.Time, time.Time, error) {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	end := time.Date(y, m, d, 23, 59, 59, 999999999, t.Location())
+	return start, end, nil
+}
+
+// start から end までの日数を返す（夏時間で 1 日の長さが変わっても暦日で数える）
+func calendarDays(start, end time.Time) int {
+	sy, sm, sd := start.Date()
+	ey, em, ed := end.Date()
+	from := time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)
+	to := time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours()/24) + 1
+}
 
-	return startOfDay, endOfDay, nil
+// 指定日時を含む週（月曜始まり）の開始日時と終了日時を返す
+func weekBounds(t time.Time) (time.Time, time.Time, error) {
+	offset := (int(t.Weekday()) + 6) % 7
+	start, _, _ := dayBounds(t.AddDate(0, 0, -offset))
+	_, end, _ := dayBounds(start.AddDate(0, 0, 6))
+	return start, end, nil
 }
@@ -60,6 +60,30 @@ func TestParseDateInput(t *testing.T) {
 			input:   "20230229",
 			wantErr: true,
 		},
+		{
+			name:      "MMDD range",
+			input:     "1014-1017",
+			wantStart: time.Date(2024, 10, 14, 0, 0, 0, 0, jst),
+			wantEnd:   time.Date(2024, 10, 17, 23, 59, 59, 999999999, jst),
+			wantErr:   false,
+		},
+		{
+			name:      "YYYYMMDD range across years",
+			input:     "20231230-20240102",
+			wantStart: time.Date(2023, 12, 30, 0, 0, 0, 0, jst),
+			wantEnd:   time.Date(2024, 1, 2, 23, 59, 59, 999999999, jst),
+			wantErr:   false,
+		},
+		{
+			name:    "Range reversed",
+			input:   "1017-1014",
+			wantErr: true,
+		},
+		{
+			name:    "Range invalid side",
+			input:   "1014-1332",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -80,3 +104,157 @@ func TestParseDateInput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDateRange(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	now := time.Date(2024, 10, 17, 15, 0, 0, 0, jst)
+
+	tests := []struct {
+		name      string
+		from      string
+		to        string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "from and to",
+			from:      "1014",
+			to:        "1017",
+			wantStart: time.Date(2024, 10, 14, 0, 0, 0, 0, jst),
+			wantEnd:   time.Date(2024, 10, 17, 23, 59, 59, 999999999, jst),
+		},
+		{
+			name:      "same day",
+			from:      "1017",
+			to:        "1017",
+			wantStart: time.Date(2024, 10, 17, 0, 0, 0, 0, jst),
+			wantEnd:   time.Date(2024, 10, 17, 23, 59, 59, 999999999, jst),
+		},
+		{
+			name:      "to omitted means today",
+			from:      "1010",
+			wantStart: time.Date(2024, 10, 10, 0, 0, 0, 0, jst),
+			wantEnd:   time.Date(2024, 10, 17, 23, 59, 59, 999999999, jst),
+		},
+		{
+			name:    "from missing",
+			to:      "1017",
+			wantErr: true,
+		},
+		{
+			name:    "too long",
+			from:    "0101",
+			to:      "1017",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd, err := ParseDateRange(tt.from, tt.to, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDateRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				if !gotStart.Equal(tt.wantStart) {
+					t.Errorf("ParseDateRange() gotStart = %v, want %v", gotStart, tt.wantStart)
+				}
+				if !gotEnd.Equal(tt.wantEnd) {
+					t.Errorf("ParseDateRange() gotEnd = %v, want %v", gotEnd, tt.wantEnd)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDateInputExpressions(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	// Mock "now" as Saturday 2026-10-17 15:00 JST
+	now := time.Date(2026, 10, 17, 15, 0, 0, 0, jst)
+	day := func(y int, m time.Month, d int) (time.Time, time.Time) {
+		return time.Date(y, m, d, 0, 0, 0, 0, jst), time.Date(y, m, d, 23, 59, 59, 999999999, jst)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantFrom [3]int
+		wantTo   [3]int
+		wantErr  bool
+	}{
+		{name: "today", input: "today", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "today (ja)", input: "今日", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "yesterday", input: "Yesterday", wantFrom: [3]int{2026, 10, 16}, wantTo: [3]int{2026, 10, 16}},
+		{name: "yesterday (ja)", input: "昨日", wantFrom: [3]int{2026, 10, 16}, wantTo: [3]int{2026, 10, 16}},
+		{name: "days ago", input: "-3d", wantFrom: [3]int{2026, 10, 14}, wantTo: [3]int{2026, 10, 14}},
+		{name: "days ago (ja)", input: "3日前", wantFrom: [3]int{2026, 10, 14}, wantTo: [3]int{2026, 10, 14}},
+		{name: "last week", input: "last week", wantFrom: [3]int{2026, 10, 5}, wantTo: [3]int{2026, 10, 11}},
+		{name: "last week (ja)", input: "先週", wantFrom: [3]int{2026, 10, 5}, wantTo: [3]int{2026, 10, 11}},
+		{name: "this week", input: "今週", wantFrom: [3]int{2026, 10, 12}, wantTo: [3]int{2026, 10, 17}},
+		{name: "weekday today", input: "saturday", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "weekday past", input: "mon", wantFrom: [3]int{2026, 10, 12}, wantTo: [3]int{2026, 10, 12}},
+		{name: "weekday (ja)", input: "金曜日", wantFrom: [3]int{2026, 10, 16}, wantTo: [3]int{2026, 10, 16}},
+		{name: "slash", input: "10/17", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "iso", input: "2025-10-17", wantFrom: [3]int{2025, 10, 17}, wantTo: [3]int{2025, 10, 17}},
+		{name: "kanji", input: "10月17日", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "kanji with year", input: "2025年1月5日", wantFrom: [3]int{2025, 1, 5}, wantTo: [3]int{2025, 1, 5}},
+		{name: "full width", input: "１０１７", wantFrom: [3]int{2026, 10, 17}, wantTo: [3]int{2026, 10, 17}},
+		{name: "iso range", input: "2026-10-14-2026-10-17", wantFrom: [3]int{2026, 10, 14}, wantTo: [3]int{2026, 10, 17}},
+		{name: "slash range", input: "10/14-10/17", wantFrom: [3]int{2026, 10, 14}, wantTo: [3]int{2026, 10, 17}},
+		{name: "relative range", input: "-3d~today", wantFrom: [3]int{2026, 10, 14}, wantTo: [3]int{2026, 10, 17}},
+		{name: "ja range", input: "先週〜昨日", wantFrom: [3]int{2026, 10, 5}, wantTo: [3]int{2026, 10, 16}},
+		{name: "unknown word", input: "someday", wantErr: true},
+		{name: "invalid slash date", input: "2/30", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd, err := ParseDateInput(tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDateInput(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			wantStart, _ := day(tt.wantFrom[0], time.Month(tt.wantFrom[1]), tt.wantFrom[2])
+			_, wantEnd := day(tt.wantTo[0], time.Month(tt.wantTo[1]), tt.wantTo[2])
+			if !gotStart.Equal(wantStart) {
+				t.Errorf("ParseDateInput(%q) gotStart = %v, want %v", tt.input, gotStart, wantStart)
+			}
+			if !gotEnd.Equal(wantEnd) {
+				t.Errorf("ParseDateInput(%q) gotEnd = %v, want %v", tt.input, gotEnd, wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseDateInputLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata not available: %v", err)
+	}
+	// DST ends in New York on 2026-11-01, so the day is 25 hours long
+	now := time.Date(2026, 11, 1, 12, 0, 0, 0, ny)
+
+	gotStart, gotEnd, err := ParseDateInput("today", now)
+	if err != nil {
+		t.Fatalf("ParseDateInput() error = %v", err)
+	}
+	if want := time.Date(2026, 11, 1, 0, 0, 0, 0, ny); !gotStart.Equal(want) {
+		t.Errorf("ParseDateInput() gotStart = %v, want %v", gotStart, want)
+	}
+	if want := time.Date(2026, 11, 1, 23, 59, 59, 999999999, ny); !gotEnd.Equal(want) {
+		t.Errorf("ParseDateInput() gotEnd = %v, want %v", gotEnd, want)
+	}
+	if got := gotEnd.Sub(gotStart).Round(time.Hour); got != 25*time.Hour {
+		t.Errorf("day length = %v, want 25h", got)
+	}
+
+	// The range check counts calendar days, not 24 hour blocks
+	if _, _, err := ParseDateRange("1002", "1101", now); err != nil {
+		t.Errorf("ParseDateRange() 31 days across DST error = %v", err)
+	}
+}
@@ -1,12 +1,179 @@
 package util
 
 import (
-	"regexp"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-var urlRegex = regexp.MustCompile(`https?://[\w!?/+\-_~=;.,*&@#$%()'[\]]+`)
+// メッセージ本文から抽出したリンク
+type ExtractedLink struct {
+	URL   string
+	Label string // マスクリンク [label](url) の表示テキスト。通常の URL では空
+}
+
+// URL の区切りとして扱う全角の記号
+const fullWidthDelimiters = "　、。，．「」『』（）【】〈〉《》〔〕｛｝＜＞！？：；”“’‘…・"
+
+// URL の末尾にあっても URL の一部とみなさない記号
+const trailingPunctuation = ".,:;!?'*_~"
 
 // 文字列から URL を抽出する
 func ExtractURLs(text string) []string {
-	return urlRegex.FindAllString(text, -1)
+	var urls []string
+	for _, link := range ExtractLinks(text) {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
+
+// 文字列から Discord のマークダウンを考慮してリンクを抽出する
+//   - マスクリンク [label](url) は URL と表示テキストを返す
+//   - 埋め込みを抑制した <url> は括弧を含めない
+//   - 文末の句読点や、対応の取れていない閉じ括弧は URL に含めない
+//   - 全角の句読点・括弧・空白と、スポイラーの || で URL を区切る
+//   - 国際化ドメイン名 (IDN) や日本語を含むパスはそのまま返す
+func ExtractLinks(text string) []ExtractedLink {
+	var links []ExtractedLink
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '[':
+			if link, n, ok := scanMaskedLink(text[i:]); ok {
+				links = append(links, link)
+				i += n
+				continue
+			}
+		case text[i] == '<':
+			if u, n, ok := scanAngleLink(text[i:]); ok {
+				links = append(links, ExtractedLink{URL: u})
+				i += n
+				continue
+			}
+		case hasSchemePrefix(text[i:]) && !followsWordChar(text, i):
+			if u, n := scanBareURL(text[i:]); u != "" {
+				links = append(links, ExtractedLink{URL: u})
+				i += n
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return links
+}
+
+// [label](url) または [label](<url>) を読み取る
+func scanMaskedLink(s string) (ExtractedLink, int, bool) {
+	end := strings.Index(s, "](")
+	if end < 0 {
+		return ExtractedLink{}, 0, false
+	}
+	label := s[1:end]
+	if label == "" || strings.ContainsAny(label, "[]\n") {
+		return ExtractedLink{}, 0, false
+	}
+
+	rest := s[end+2:]
+	var u string
+	var n int
+	if strings.HasPrefix(rest, "<") {
+		var ok bool
+		u, n, ok = scanAngleLink(rest)
+		if !ok || !strings.HasPrefix(rest[n:], ")") {
+			return ExtractedLink{}, 0, false
+		}
+	} else {
+		if !hasSchemePrefix(rest) {
+			return ExtractedLink{}, 0, false
+		}
+		u, n = scanBareURL(rest)
+		if u == "" || !strings.HasPrefix(rest[n:], ")") {
+			return ExtractedLink{}, 0, false
+		}
+	}
+	return ExtractedLink{URL: u, Label: strings.TrimSpace(label)}, end + 2 + n + 1, true
+}
+
+// <url> を読み取る。n は閉じ括弧までの長さ
+func scanAngleLink(s string) (string, int, bool) {
+	end := strings.IndexByte(s, '>')
+	if end < 0 {
+		return "", 0, false
+	}
+	u := s[1:end]
+	if !hasSchemePrefix(u) || strings.IndexFunc(u, unicode.IsSpace) >= 0 || !isValidURL(u) {
+		return "", 0, false
+	}
+	return u, end + 1, true
+}
+
+// 区切り文字までを URL として読み取り、末尾の句読点や余分な閉じ括弧を取り除く
+// n は取り除いた後の URL の長さ
+func scanBareURL(s string) (string, int) {
+	end := len(s)
+	for i, r := range s {
+		if isURLTerminator(r) || strings.HasPrefix(s[i:], "||") {
+			end = i
+			break
+		}
+	}
+	u := trimURLSuffix(s[:end])
+	if !isValidURL(u) {
+		return "", 0
+	}
+	return u, len(u)
+}
+
+// 末尾の句読点と、対応する開き括弧のない閉じ括弧を取り除く
+func trimURLSuffix(u string) string {
+	for u != "" {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(trailingPunctuation, last) >= 0:
+			u = u[:len(u)-1]
+		case last == ')' && strings.Count(u, ")") > strings.Count(u, "("):
+			u = u[:len(u)-1]
+		case last == ']' && strings.Count(u, "]") > strings.Count(u, "["):
+			u = u[:len(u)-1]
+		default:
+			return u
+		}
+	}
+	return u
+}
+
+func isURLTerminator(r rune) bool {
+	if unicode.IsSpace(r) || unicode.IsControl(r) {
+		return true
+	}
+	switch r {
+	case '<', '>', '"', '`', '{', '}', '\\':
+		return true
+	}
+	return strings.ContainsRune(fullWidthDelimiters, r)
+}
+
+// http:// または https:// で始まるか（大文字小文字は区別しない）
+func hasSchemePrefix(s string) bool {
+	for _, scheme := range []string{"http://", "https://"} {
+		if len(s) >= len(scheme) && strings.EqualFold(s[:len(scheme)], scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// 直前が英数字の場合は単語の途中なので URL の開始とみなさない
+func followsWordChar(text string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isValidURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Host != "" && u.Hostname() != ""
 }
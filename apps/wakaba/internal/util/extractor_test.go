@@ -31,6 +31,61 @@ func TestExtractURLs(t *testing.T) {
 			text: "Complex: https://site.com/foo_bar-baz?a=b&c=d#anchor",
 			want: []string{"https://site.com/foo_bar-baz?a=b&c=d#anchor"},
 		},
+		{
+			name: "trailing sentence punctuation",
+			text: "See https://example.com/page. Also https://example.com/faq, https://example.com/q? and (https://example.com/paren)!",
+			want: []string{"https://example.com/page", "https://example.com/faq", "https://example.com/q", "https://example.com/paren"},
+		},
+		{
+			name: "balanced parentheses",
+			text: "wiki: https://en.wikipedia.org/wiki/Go_(programming_language) (via https://example.com/a_(b))",
+			want: []string{"https://en.wikipedia.org/wiki/Go_(programming_language)", "https://example.com/a_(b)"},
+		},
+		{
+			name: "angle brackets",
+			text: "no embed <https://example.com/path?a=1> and <not a url>",
+			want: []string{"https://example.com/path?a=1"},
+		},
+		{
+			name: "masked link",
+			text: "read [the docs](https://example.com/docs) now",
+			want: []string{"https://example.com/docs"},
+		},
+		{
+			name: "masked link with angle brackets and parentheses",
+			text: "[Go](<https://en.wikipedia.org/wiki/Go_(programming_language)>) [wiki](https://en.wikipedia.org/wiki/Go_(programming_language))",
+			want: []string{"https://en.wikipedia.org/wiki/Go_(programming_language)", "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		},
+		{
+			name: "full-width delimiters",
+			text: "これ→https://example.com/a、あと「https://example.com/b」と（https://example.com/c）。最後はhttps://example.com/d　です",
+			want: []string{"https://example.com/a", "https://example.com/b", "https://example.com/c", "https://example.com/d"},
+		},
+		{
+			name: "japanese path and IDN host",
+			text: "https://ja.wikipedia.org/wiki/東京都 と https://日本語.jp/パス を見て",
+			want: []string{"https://ja.wikipedia.org/wiki/東京都", "https://日本語.jp/パス"},
+		},
+		{
+			name: "spoiler",
+			text: "||https://example.com/secret|| and ||[hidden](https://example.com/hidden)||",
+			want: []string{"https://example.com/secret", "https://example.com/hidden"},
+		},
+		{
+			name: "markdown emphasis",
+			text: "**https://example.com/bold** __https://example.com/underline__ `https://example.com/code`",
+			want: []string{"https://example.com/bold", "https://example.com/underline", "https://example.com/code"},
+		},
+		{
+			name: "uppercase scheme and scheme inside a word",
+			text: "HTTPS://Example.com/A xhttps://example.com/ignored",
+			want: []string{"HTTPS://Example.com/A"},
+		},
+		{
+			name: "scheme only",
+			text: "https:// and http://",
+			want: nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -41,3 +96,43 @@ func TestExtractURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []ExtractedLink
+	}{
+		{
+			name: "masked link label",
+			text: "[ the docs ](https://example.com/docs) and https://example.com/plain",
+			want: []ExtractedLink{
+				{URL: "https://example.com/docs", Label: "the docs"},
+				{URL: "https://example.com/plain"},
+			},
+		},
+		{
+			name: "japanese label with angle brackets",
+			text: "[公式サイト](<https://example.com/>)",
+			want: []ExtractedLink{{URL: "https://example.com/", Label: "公式サイト"}},
+		},
+		{
+			name: "not a masked link",
+			text: "[note](see below) https://example.com/",
+			want: []ExtractedLink{{URL: "https://example.com/"}},
+		},
+		{
+			name: "brackets around url",
+			text: "[https://example.com/a]",
+			want: []ExtractedLink{{URL: "https://example.com/a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractLinks(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractLinks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
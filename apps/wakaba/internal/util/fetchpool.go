@@ -0,0 +1,166 @@
+package util
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URL ごとの処理を、全体の並列数・ホストごとの並列数・ホストごとの間隔を守りながら実行する
+// 制限は同じ FetchPool で同時に実行しているすべての Run にまたがって適用される
+type FetchPool struct {
+	Workers int           // 全体で同時に実行する数
+	PerHost int           // 同じホストに対して同時に実行する数
+	Delay   time.Duration // 同じホストに対してリクエストを開始する最小の間隔
+
+	mu    sync.Mutex
+	sem   chan struct{}
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	mu   sync.Mutex
+	next time.Time
+}
+
+// urls のそれぞれについて fn を実行し、fn が完了を報告したかどうかを urls と同じ順序で返す
+// fn は ctx の終了で処理を中断した場合に false を返す
+// ctx が終了した場合は新しい処理を開始せず、実行中の処理が戻るのを待ってから返す
+func (p *FetchPool) Run(ctx context.Context, urls []string, fn func(ctx context.Context, i int) bool) []bool {
+	sem := p.workerSem()
+	done := make([]bool, len(urls))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cap(sem); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				slot := p.hostSlot(hostOf(urls[i]))
+				if !slot.acquire(ctx, p.Delay) {
+					continue
+				}
+				// 他の Run と合わせた全体の並列数を守る
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					slot.release()
+					continue
+				}
+				done[i] = fn(ctx, i)
+				<-sem
+				slot.release()
+			}
+		}()
+	}
+
+	// 同じホストが連続しないように並べ替えてから投入する
+	for _, i := range interleaveByHost(urls) {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return done
+}
+
+// すべての Run で共有する、全体の並列数の枠
+func (p *FetchPool) workerSem() chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sem == nil {
+		p.sem = make(chan struct{}, max(p.Workers, 1))
+	}
+	return p.sem
+}
+
+// すべての Run で共有する、ホストごとの枠
+func (p *FetchPool) hostSlot(host string) *hostSlot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hosts == nil {
+		p.hosts = map[string]*hostSlot{}
+	}
+	slot, ok := p.hosts[host]
+	if !ok {
+		slot = &hostSlot{sem: make(chan struct{}, max(p.PerHost, 1))}
+		p.hosts[host] = slot
+	}
+	return slot
+}
+
+// ホストの枠を確保し、前回の開始から Delay が経つまで待つ
+func (s *hostSlot) acquire(ctx context.Context, delay time.Duration) bool {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	start := s.next
+	if start.Before(now) {
+		start = now
+	}
+	s.next = start.Add(delay)
+	s.mu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			s.release()
+			return false
+		}
+	}
+	return true
+}
+
+func (s *hostSlot) release() {
+	<-s.sem
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// ホストごとに 1 件ずつ順番に取り出した順序のインデックスを返す
+func interleaveByHost(urls []string) []int {
+	var order []string
+	byHost := map[string][]int{}
+	for i, u := range urls {
+		h := hostOf(u)
+		if _, ok := byHost[h]; !ok {
+			order = append(order, h)
+		}
+		byHost[h] = append(byHost[h], i)
+	}
+
+	result := make([]int, 0, len(urls))
+	for len(result) < len(urls) {
+		for _, h := range order {
+			if len(byHost[h]) > 0 {
+				result = append(result, byHost[h][0])
+				byHost[h] = byHost[h][1:]
+			}
+		}
+	}
+	return result
+}
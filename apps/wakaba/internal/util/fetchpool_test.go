@@ -0,0 +1,169 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchPoolLimits(t *testing.T) {
+	var urls []string
+	for i := 0; i < 12; i++ {
+		urls = append(urls, fmt.Sprintf("https://host%d.example/%d", i%3, i))
+	}
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	activeByHost, maxByHost := map[string]int{}, map[string]int{}
+
+	pool := &FetchPool{Workers: 4, PerHost: 1}
+	done := pool.Run(context.Background(), urls, func(ctx context.Context, i int) bool {
+		h := hostOf(urls[i])
+		mu.Lock()
+		active++
+		activeByHost[h]++
+		if active > maxActive {
+			maxActive = active
+		}
+		if activeByHost[h] > maxByHost[h] {
+			maxByHost[h] = activeByHost[h]
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		activeByHost[h]--
+		mu.Unlock()
+		return true
+	})
+
+	for i, d := range done {
+		if !d {
+			t.Errorf("done[%d] = false, want true", i)
+		}
+	}
+	if maxActive > 4 {
+		t.Errorf("max concurrent = %d, want <= 4", maxActive)
+	}
+	for h, n := range maxByHost {
+		if n > 1 {
+			t.Errorf("max concurrent for %s = %d, want <= 1", h, n)
+		}
+	}
+}
+
+func TestFetchPoolSharedAcrossRuns(t *testing.T) {
+	// チャンネルごとに同時に Run しても、全体とホストごとの並列数は 1 つの Run と同じ
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	activeByHost, maxByHost := map[string]int{}, map[string]int{}
+
+	pool := &FetchPool{Workers: 3, PerHost: 1}
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		urls := []string{fmt.Sprintf("https://a.example/%d", r), fmt.Sprintf("https://b.example/%d", r), fmt.Sprintf("https://c.example/%d", r), fmt.Sprintf("https://d.example/%d", r)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(context.Background(), urls, func(ctx context.Context, i int) bool {
+				h := hostOf(urls[i])
+				mu.Lock()
+				active++
+				activeByHost[h]++
+				maxActive = max(maxActive, active)
+				maxByHost[h] = max(maxByHost[h], activeByHost[h])
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				active--
+				activeByHost[h]--
+				mu.Unlock()
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+
+	if maxActive > 3 {
+		t.Errorf("max concurrent = %d, want <= 3", maxActive)
+	}
+	for h, n := range maxByHost {
+		if n > 1 {
+			t.Errorf("max concurrent for %s = %d, want <= 1", h, n)
+		}
+	}
+}
+
+func TestFetchPoolDelay(t *testing.T) {
+	urls := []string{"https://a.example/1", "https://a.example/2", "https://a.example/3"}
+
+	var mu sync.Mutex
+	var starts []time.Time
+
+	pool := &FetchPool{Workers: 3, PerHost: 3, Delay: 30 * time.Millisecond}
+	pool.Run(context.Background(), urls, func(ctx context.Context, i int) bool {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		return true
+	})
+
+	if len(starts) != 3 {
+		t.Fatalf("len(starts) = %d, want 3", len(starts))
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("gap between request %d and %d = %v, want >= 30ms", i-1, i, gap)
+		}
+	}
+}
+
+func TestFetchPoolDeadline(t *testing.T) {
+	urls := []string{"https://fast.example/", "https://slow.example/1", "https://slow.example/2"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	pool := &FetchPool{Workers: 3, PerHost: 1}
+	done := pool.Run(ctx, urls, func(ctx context.Context, i int) bool {
+		if hostOf(urls[i]) == "fast.example" {
+			return true
+		}
+		select {
+		case <-time.After(time.Second):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run() took %v, want it to stop at the deadline", elapsed)
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(done, want) {
+		t.Errorf("Run() = %v, want %v", done, want)
+	}
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	urls := []string{
+		"https://a.example/1",
+		"https://a.example/2",
+		"https://a.example/3",
+		"https://b.example/1",
+		"https://c.example/1",
+		"https://b.example/2",
+	}
+	want := []int{0, 3, 4, 1, 5, 2}
+	if got := interleaveByHost(urls); !reflect.DeepEqual(got, want) {
+		t.Errorf("interleaveByHost() = %v, want %v", got, want)
+	}
+}
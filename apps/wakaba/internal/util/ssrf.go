@@ -0,0 +1,168 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 取得先として許可されていないアドレスやURLへのアクセスを示すエラー
+var ErrForbiddenDestination = errors.New("forbidden destination")
+
+// 内部ネットワークやクラウドのメタデータ API など、外部から取得させてはいけないアドレス
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local (incl. 169.254.169.254 metadata)
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments (incl. 192.0.0.192 metadata)
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64 (can reach IPv4 private ranges)
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001::/32"),       // Teredo (embeds an IPv4 address)
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4 (embeds an IPv4 address)
+	netip.MustParsePrefix("fc00::/7"),        // unique local (incl. fd00:ec2::254 metadata)
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// リンク先を取得する際に許可する宛先
+type FetchPolicy struct {
+	Schemes []string // 許可するスキーム
+	Ports   []string // 許可するポート（URL に書かれていない場合はスキームのデフォルト）
+	// forbiddenPrefixes の例外として許可するアドレス（テスト用）
+	AllowedPrefixes []netip.Prefix
+}
+
+// 通常のリンク取得で使う宛先の制限
+var DefaultFetchPolicy = &FetchPolicy{
+	Schemes: []string{"http", "https"},
+	Ports:   []string{"80", "443", "8080", "8443"},
+}
+
+// URL のスキームとポートが許可されているか確認する
+func (p *FetchPolicy) CheckURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if !slices.Contains(p.Schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrForbiddenDestination, u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: empty host", ErrForbiddenDestination)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultPort(scheme)
+	}
+	if !slices.Contains(p.Ports, port) {
+		return fmt.Errorf("%w: port %s is not allowed", ErrForbiddenDestination, port)
+	}
+	return nil
+}
+
+// 接続先のアドレスが許可されているか確認する
+func (p *FetchPolicy) CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, prefix := range p.AllowedPrefixes {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: address %s is in %s", ErrForbiddenDestination, addr, prefix)
+		}
+	}
+	return nil
+}
+
+// 名前解決後、実際に接続する直前のアドレスを確認する
+// DNS の応答が途中で変わっても（DNS rebinding）、接続先そのものを検査するので防げる
+func (p *FetchPolicy) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: cannot parse address %q", ErrForbiddenDestination, address)
+	}
+	if err := p.CheckAddr(addrPort.Addr()); err != nil {
+		return err
+	}
+	if !slices.Contains(p.Ports, fmt.Sprint(addrPort.Port())) {
+		return fmt.Errorf("%w: port %d is not allowed", ErrForbiddenDestination, addrPort.Port())
+	}
+	return nil
+}
+
+// 宛先を制限した http.Transport を返す
+// プロキシを経由すると接続先を検査できないため、プロキシは使わない
+func NewGuardedTransport(p *FetchPolicy) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: p.control,
+	}
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// 宛先を制限した http.Client を返す
+// リダイレクト先も同じ制限で確認する
+func NewGuardedClient(p *FetchPolicy, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &guardedRoundTripper{policy: p, base: NewGuardedTransport(p)},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			return p.CheckURL(req.URL)
+		},
+	}
+}
+
+// リクエストごとに URL を確認する RoundTripper
+type guardedRoundTripper struct {
+	policy *FetchPolicy
+	base   http.RoundTripper
+}
+
+func (t *guardedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// テストサーバー（ループバック）への取得を許可した Client に差し替える
+func allowTestServer(t *testing.T, ts *httptest.Server) {
+	t.Helper()
+
+	u, _ := url.Parse(ts.URL)
+	policy := &FetchPolicy{
+		Schemes:         []string{"http"},
+		Ports:           []string{u.Port()},
+		AllowedPrefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	}
+
+	orig := httpClient
+	httpClient = NewGuardedClient(policy, 5*time.Second)
+	t.Cleanup(func() { httpClient = orig })
+}
+
+func TestFetchPolicyCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://example.com/", wantErr: false},
+		{url: "http://example.com/", wantErr: false},
+		{url: "https://example.com:8443/", wantErr: false},
+		{url: "HTTPS://example.com/", wantErr: false},
+		{url: "ftp://example.com/", wantErr: true},
+		{url: "file:///etc/passwd", wantErr: true},
+		{url: "gopher://example.com:70/", wantErr: true},
+		{url: "http://example.com:22/", wantErr: true},
+		{url: "https://example.com:6379/", wantErr: true},
+		{url: "http:///path-only", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = DefaultFetchPolicy.CheckURL(u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckURL(%s) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrForbiddenDestination) {
+				t.Errorf("CheckURL(%s) error = %v, want ErrForbiddenDestination", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestFetchPolicyCheckAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "93.184.216.34", wantErr: false},
+		{addr: "8.8.8.8", wantErr: false},
+		{addr: "2606:4700::1111", wantErr: false},
+		{addr: "127.0.0.1", wantErr: true},
+		{addr: "127.1.2.3", wantErr: true},
+		{addr: "169.254.169.254", wantErr: true},
+		{addr: "10.0.0.1", wantErr: true},
+		{addr: "172.16.5.4", wantErr: true},
+		{addr: "192.168.1.1", wantErr: true},
+		{addr: "100.64.0.1", wantErr: true},
+		{addr: "0.0.0.0", wantErr: true},
+		{addr: "::1", wantErr: true},
+		{addr: "::", wantErr: true},
+		{addr: "::ffff:127.0.0.1", wantErr: true},
+		{addr: "::ffff:169.254.169.254", wantErr: true},
+		{addr: "fd00:ec2::254", wantErr: true},
+		{addr: "fe80::1", wantErr: true},
+		{addr: "64:ff9b::a00:1", wantErr: true},
+		{addr: "2002:a00:1::1", wantErr: true},               // 6to4 (10.0.0.1)
+		{addr: "2002:a9fe:a9fe::1", wantErr: true},           // 6to4 (169.254.169.254)
+		{addr: "2001:0:4136:e378::f5ff:fffe", wantErr: true}, // Teredo
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := DefaultFetchPolicy.CheckAddr(netip.MustParseAddr(tt.addr))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckAddr(%s) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGuardedClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata-redirect":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		case "/scheme-redirect":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/port-redirect":
+			http.Redirect(w, r, "http://example.com:22/", http.StatusFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	port := u.Port()
+
+	// ループバックのリスナーは、ポートを許可しても名前解決後のアドレスで拒否される
+	blocked := NewGuardedClient(&FetchPolicy{Schemes: []string{"http"}, Ports: []string{port, "80"}}, time.Second)
+	for _, target := range []string{
+		ts.URL + "/",
+		"http://localhost:" + port + "/",
+		"http://[::ffff:127.0.0.1]:" + port + "/",
+	} {
+		t.Run("blocked "+target, func(t *testing.T) {
+			resp, err := blocked.Get(target)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("Get(%s) succeeded, want forbidden", target)
+			}
+			if !errors.Is(err, ErrForbiddenDestination) {
+				t.Errorf("Get(%s) error = %v, want ErrForbiddenDestination", target, err)
+			}
+		})
+	}
+
+	// テストサーバーだけを例外として許可しても、リダイレクト先は確認される
+	allowed := NewGuardedClient(&FetchPolicy{
+		Schemes:         []string{"http"},
+		Ports:           []string{port, "80"},
+		AllowedPrefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	}, time.Second)
+
+	resp, err := allowed.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Get() allowed server error = %v", err)
+	}
+	resp.Body.Close()
+
+	for _, path := range []string{"/metadata-redirect", "/scheme-redirect", "/port-redirect"} {
+		t.Run("redirect "+path, func(t *testing.T) {
+			resp, err := allowed.Get(ts.URL + path)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("Get(%s) succeeded, want forbidden", path)
+			}
+			if !errors.Is(err, ErrForbiddenDestination) {
+				t.Errorf("Get(%s) error = %v, want ErrForbiddenDestination", path, err)
+			}
+		})
+	}
+}
@@ -1,53 +1,207 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strings"
 	"time"
 
+	"golang.org/x/net/html"
 	"golang.org/x/net/html/charset"
 )
 
-var titleRegex = regexp.MustCompile(`(?i)<title>(.*?)</title>`)
+const userAgent = "Mozilla/5.0 (compatible; wakaba/1.0; +https://github.com/ulxsth/wakaba)"
+
+// リンク先の取得で共有する Client（接続を使い回し、内部ネットワークへのアクセスを防ぐ）
+var httpClient = NewGuardedClient(DefaultFetchPolicy, 5*time.Second)
+
+// ページのメタデータ
+// OG* は OpenGraph の値を優先し、なければ Twitter Card などの値で補う
+type PageMetadata struct {
+	Title         string // <title>
+	OGTitle       string // og:title / twitter:title
+	OGDescription string // og:description / twitter:description / description
+	OGSiteName    string // og:site_name
+	OGImage       string // og:image / twitter:image (absolute URL)
+	CanonicalURL  string // <link rel="canonical"> / og:url (absolute URL)
+	ContentType   string // Content-Type without parameters (e.g. "text/html")
+}
+
+// 表示に使うタイトルを返す（og:title を優先する）
+func (m *PageMetadata) DisplayTitle() string {
+	if m.OGTitle != "" {
+		return m.OGTitle
+	}
+	return m.Title
+}
 
 // 受け取ったurl先のタイトルを取得して返す
 func FetchPageTitle(url string) (string, error) {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+	meta, err := FetchPageMetadata(url)
+	if err != nil {
+		return "", err
+	}
+
+	if title := meta.DisplayTitle(); title != "" {
+		return title, nil
+	}
+	return "", fmt.Errorf("title not found")
+}
+
+// 受け取ったurl先のメタデータを取得して返す
+// HTML 以外のコンテンツの場合は ContentType のみを設定して返す
+func FetchPageMetadata(url string) (*PageMetadata, error) {
+	return FetchPageMetadataContext(context.Background(), url)
+}
+
+// FetchPageMetadata と同じだが、ctx が終了した時点で取得を中断する
+func FetchPageMetadataContext(ctx context.Context, url string) (*PageMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("User-Agent", userAgent)
 
-	resp, err := client.Get(url)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	meta := &PageMetadata{}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		meta.ContentType = mediaType
+	}
+	if meta.ContentType != "" && meta.ContentType != "text/html" && meta.ContentType != "application/xhtml+xml" {
+		return meta, nil
 	}
 
 	limitReader := io.LimitReader(resp.Body, 500*1024)
-	utf8Reader, err := charset.NewReader(limitReader, resp.Header.Get("Content-Type"))
+	utf8Reader, err := charset.NewReader(limitReader, contentType)
 	if err != nil {
 		utf8Reader = limitReader
 	}
 
-	bodyBytes, err := io.ReadAll(utf8Reader)
-	if err != nil {
-		return "", err
+	parseMetadata(utf8Reader, resp.Request.URL, meta)
+	return meta, nil
+}
+
+// HTML をトークン単位で読み、<head> 内のメタデータを取り出す
+func parseMetadata(r io.Reader, base *url.URL, meta *PageMetadata) {
+	var twitterTitle, twitterDescription, twitterImage, description, ogURL string
+	var title strings.Builder
+	inTitle, titleDone := false, false
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.Data {
+			case "title":
+				inTitle = !titleDone
+			case "meta":
+				key := strings.ToLower(attr(tok, "property"))
+				if key == "" {
+					key = strings.ToLower(attr(tok, "name"))
+				}
+				content := strings.TrimSpace(attr(tok, "content"))
+				switch key {
+				case "og:title":
+					meta.OGTitle = content
+				case "og:description":
+					meta.OGDescription = content
+				case "og:site_name":
+					meta.OGSiteName = content
+				case "og:image", "og:image:url":
+					if meta.OGImage == "" {
+						meta.OGImage = content
+					}
+				case "og:url":
+					ogURL = content
+				case "twitter:title":
+					twitterTitle = content
+				case "twitter:description":
+					twitterDescription = content
+				case "twitter:image":
+					twitterImage = content
+				case "description":
+					description = content
+				}
+			case "link":
+				if strings.EqualFold(attr(tok, "rel"), "canonical") {
+					meta.CanonicalURL = strings.TrimSpace(attr(tok, "href"))
+				}
+			case "body":
+				// メタデータは <head> にあるので、本文に入ったら終了
+				goto DONE
+			}
+		case html.TextToken:
+			if inTitle {
+				title.WriteString(tok.Data)
+			}
+		case html.EndTagToken:
+			switch tok.Data {
+			case "title":
+				inTitle, titleDone = false, true
+			case "head":
+				goto DONE
+			}
+		}
 	}
 
-	content := string(bodyBytes)
-	content = strings.ReplaceAll(content, "\n", " ")
+DONE:
+	meta.Title = strings.Join(strings.Fields(title.String()), " ")
+	if meta.OGTitle == "" {
+		meta.OGTitle = twitterTitle
+	}
+	if meta.OGDescription == "" {
+		meta.OGDescription = twitterDescription
+	}
+	if meta.OGDescription == "" {
+		meta.OGDescription = description
+	}
+	if meta.OGImage == "" {
+		meta.OGImage = twitterImage
+	}
+	if meta.CanonicalURL == "" {
+		meta.CanonicalURL = ogURL
+	}
+	meta.OGImage = resolveURL(base, meta.OGImage)
+	meta.CanonicalURL = resolveURL(base, meta.CanonicalURL)
+}
 
-	match := titleRegex.FindStringSubmatch(content)
-	if len(match) > 1 {
-		title := strings.TrimSpace(match[1])
-		return title, nil
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
 	}
+	return ""
+}
 
-	return "", fmt.Errorf("title not found")
+// 相対 URL を base からの絶対 URL にする
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
 }
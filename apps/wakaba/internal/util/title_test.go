@@ -15,6 +15,9 @@ func TestFetchPageTitle(t *testing.T) {
 		case "/no-title":
 			w.Header().Set("Content-Type", "text/html")
 			w.Write([]byte(`<html><body>No Title Here</body></html>`))
+		case "/og-title":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>App</title><meta property="og:title" content="Real Name"></head></html>`))
 		case "/utf8-meta":
 			w.Header().Set("Content-Type", "text/html")
 			w.Write([]byte(`<html><head><meta charset="utf-8"><title>UTF-8 Title</title></head></html>`))
@@ -23,6 +26,7 @@ func TestFetchPageTitle(t *testing.T) {
 		}
 	}))
 	defer ts.Close()
+	allowTestServer(t, ts)
 
 	tests := []struct {
 		name    string
@@ -36,6 +40,12 @@ func TestFetchPageTitle(t *testing.T) {
 			want:    "Test Page Title",
 			wantErr: false,
 		},
+		{
+			name:    "og:title preferred",
+			url:     ts.URL + "/og-title",
+			want:    "Real Name",
+			wantErr: false,
+		},
 		{
 			name:    "No Title",
 			url:     ts.URL + "/no-title",
@@ -61,3 +71,119 @@ func TestFetchPageTitle(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchPageMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/og":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<!doctype html><html><head>
+<title>Loading...</title>
+<meta property="og:title" content="Real Article Name">
+<meta property="og:description" content="What the article is about">
+<meta property="og:site_name" content="Example News">
+<meta property="og:image" content="/img/cover.png">
+<link rel="canonical" href="https://example.com/articles/1">
+</head><body><title>Not this</title></body></html>`))
+		case "/twitter":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+<meta name="twitter:title" content="Tweet Card Title">
+<meta name="twitter:description" content="Card description">
+<meta name="twitter:image" content="https://cdn.example.com/card.jpg">
+<meta property="og:url" content="/canonical">
+</head></html>`))
+		case "/plain":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>
+  Multi
+  Line &amp; Entities
+</title><meta name="description" content="Plain description"></head></html>`))
+		case "/shift_jis":
+			w.Header().Set("Content-Type", "text/html; charset=shift_jis")
+			// "日本語" in Shift_JIS
+			w.Write([]byte("<html><head><title>\x93\xfa\x96\x7b\x8c\xea</title></head></html>"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	allowTestServer(t, ts)
+
+	tests := []struct {
+		name    string
+		url     string
+		want    PageMetadata
+		wantErr bool
+	}{
+		{
+			name: "OpenGraph",
+			url:  ts.URL + "/og",
+			want: PageMetadata{
+				Title:         "Loading...",
+				OGTitle:       "Real Article Name",
+				OGDescription: "What the article is about",
+				OGSiteName:    "Example News",
+				OGImage:       ts.URL + "/img/cover.png",
+				CanonicalURL:  "https://example.com/articles/1",
+				ContentType:   "text/html",
+			},
+		},
+		{
+			name: "Twitter Card fallback",
+			url:  ts.URL + "/twitter",
+			want: PageMetadata{
+				OGTitle:       "Tweet Card Title",
+				OGDescription: "Card description",
+				OGImage:       "https://cdn.example.com/card.jpg",
+				CanonicalURL:  ts.URL + "/canonical",
+				ContentType:   "text/html",
+			},
+		},
+		{
+			name: "Plain title and description",
+			url:  ts.URL + "/plain",
+			want: PageMetadata{
+				Title:         "Multi Line & Entities",
+				OGDescription: "Plain description",
+				ContentType:   "text/html",
+			},
+		},
+		{
+			name: "Shift_JIS",
+			url:  ts.URL + "/shift_jis",
+			want: PageMetadata{
+				Title:       "日本語",
+				ContentType: "text/html",
+			},
+		},
+		{
+			name: "Non HTML",
+			url:  ts.URL + "/image",
+			want: PageMetadata{
+				ContentType: "image/png",
+			},
+		},
+		{
+			name:    "404",
+			url:     ts.URL + "/not-found",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FetchPageMetadata(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FetchPageMetadata() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("FetchPageMetadata() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // Lambda の実行環境にタイムゾーンデータがない場合に備えて埋め込む
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -48,7 +51,13 @@ func Dispatcher(ctx context.Context, payload json.RawMessage) (interface{}, erro
 		return handler.HandleGateway(ctx, proxyReq, pubKey)
 	}
 
-	// 3. Worker Request (Async invocation)
+	// 3. EventBridge Scheduled Event (定期投稿)
+	var schedEvent events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &schedEvent); err == nil && schedEvent.DetailType == "Scheduled Event" {
+		return nil, handler.ProcessScheduledDigests(ctx, time.Now())
+	}
+
+	// 4. Worker Request (Async invocation)
 	var workerReq handler.WorkerRequest
 	if err := json.Unmarshal(payload, &workerReq); err == nil && workerReq.InteractionID != "" {
 		token := os.Getenv("DISCORD_BOT_TOKEN")
@@ -70,11 +79,21 @@ func Dispatcher(ctx context.Context, payload json.RawMessage) (interface{}, erro
 				return nil, handler.ProcessSummarize(s, &workerReq)
 			case "list":
 				return nil, handler.ProcessTodoList(s, &workerReq)
+			case "config":
+				return nil, handler.ProcessConfig(s, &workerReq)
+			case "digest":
+				return nil, handler.ProcessDigest(s, &workerReq)
 			default:
 				return nil, fmt.Errorf("unknown command: %s", workerReq.CommandName)
 			}
 		} else if workerReq.Type == "component" {
+			if strings.HasPrefix(workerReq.CustomID, "summary:") {
+				return nil, handler.ProcessSummaryComponent(s, &workerReq)
+			}
 			return nil, handler.ProcessTodoComponent(s, &workerReq)
+		} else if workerReq.Type == "digest" {
+			// 定期投稿は /summarize と同じ処理で作成する
+			return nil, handler.ProcessSummarize(s, &workerReq)
 		}
 
 		return nil, fmt.Errorf("unknown worker request type: %s", workerReq.Type)
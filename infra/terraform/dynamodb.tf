@@ -1,3 +1,5 @@
+# リスト全体を 1 行に保存していた頃の TODO テーブル
+# cmd/migrate-todo で todo_items に移行した後に、Lambda の LEGACY_TODO_TABLE_NAME と一緒に削除する
 resource "aws_dynamodb_table" "todo" {
   name         = "${var.project_name}-todo"
   billing_mode = "PAY_PER_REQUEST"
@@ -12,3 +14,108 @@ resource "aws_dynamodb_table" "todo" {
     Project = var.project_name
   }
 }
+
+# TODO リスト。リストの情報 (sk = "meta") とタスク (sk = "item#<id>") を別の行に保存する
+# 名前つきのリストは channel_id を "<channel_id>#<name>" とし、チャンネルの行に名前の一覧 (sk = "list#<name>") を保存する
+# rank-index でタスクを並び順に読む (リストの情報や名前の一覧の行は rank を持たないので含まれない)
+resource "aws_dynamodb_table" "todo_items" {
+  name         = "${var.project_name}-todo-items"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "channel_id"
+  range_key    = "sk"
+
+  attribute {
+    name = "channel_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "sk"
+    type = "S"
+  }
+
+  attribute {
+    name = "rank"
+    type = "S"
+  }
+
+  local_secondary_index {
+    name            = "rank-index"
+    range_key       = "rank"
+    projection_type = "ALL"
+  }
+
+  tags = {
+    Project = var.project_name
+  }
+}
+
+resource "aws_dynamodb_table" "settings" {
+  name         = "${var.project_name}-settings"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  tags = {
+    Project = var.project_name
+  }
+}
+
+resource "aws_dynamodb_table" "summary" {
+  name         = "${var.project_name}-summary"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = var.project_name
+  }
+}
+
+resource "aws_dynamodb_table" "link_cache" {
+  name         = "${var.project_name}-link-cache"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "url"
+
+  attribute {
+    name = "url"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Project = var.project_name
+  }
+}
+
+resource "aws_dynamodb_table" "digest" {
+  name         = "${var.project_name}-digest"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  tags = {
+    Project = var.project_name
+  }
+}
@@ -32,10 +32,19 @@ resource "aws_iam_role_policy" "dynamodb_access" {
           "dynamodb:UpdateItem",
           "dynamodb:DeleteItem",
           "dynamodb:Query",
-          "dynamodb:Scan"
+          "dynamodb:Scan",
+          "dynamodb:ConditionCheckItem"
         ]
         Effect   = "Allow"
-        Resource = aws_dynamodb_table.todo.arn
+        Resource = [
+          aws_dynamodb_table.todo.arn,
+          aws_dynamodb_table.todo_items.arn,
+          "${aws_dynamodb_table.todo_items.arn}/index/*",
+          aws_dynamodb_table.settings.arn,
+          aws_dynamodb_table.summary.arn,
+          aws_dynamodb_table.link_cache.arn,
+          aws_dynamodb_table.digest.arn,
+        ]
       },
     ]
   })
@@ -59,13 +68,23 @@ resource "aws_lambda_function" "app" {
   runtime = "provided.al2"
   architectures = ["x86_64"]
 
+  # タイトル取得の制限時間 (10 秒) と Discord API の呼び出しが収まるようにする
+  timeout = 60
+
   role = aws_iam_role.lambda_exec.arn
 
   environment {
     variables = {
-      DISCORD_PUBLIC_KEY  = var.discord_public_key
-      DISCORD_BOT_TOKEN   = var.discord_bot_token
-      DYNAMODB_TABLE_NAME = aws_dynamodb_table.todo.name
+      DISCORD_PUBLIC_KEY    = var.discord_public_key
+      DISCORD_BOT_TOKEN     = var.discord_bot_token
+      DYNAMODB_TABLE_NAME   = aws_dynamodb_table.todo_items.name
+      SETTINGS_TABLE_NAME   = aws_dynamodb_table.settings.name
+      SUMMARY_TABLE_NAME    = aws_dynamodb_table.summary.name
+      LINK_CACHE_TABLE_NAME = aws_dynamodb_table.link_cache.name
+      DIGEST_TABLE_NAME     = aws_dynamodb_table.digest.name
+
+      # 移行前のリストを読むときに todo から移行する。cmd/migrate-todo の実行後に todo と一緒に削除する
+      LEGACY_TODO_TABLE_NAME = aws_dynamodb_table.todo.name
     }
   }
 }
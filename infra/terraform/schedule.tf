@@ -0,0 +1,20 @@
+# 定期投稿 (/digest) の投稿時刻を過ぎた設定がないかを定期的に確認する
+resource "aws_cloudwatch_event_rule" "digest" {
+  name                = "${var.project_name}-digest"
+  description         = "Post scheduled link digests"
+  schedule_expression = "rate(10 minutes)"
+}
+
+resource "aws_cloudwatch_event_target" "digest" {
+  rule = aws_cloudwatch_event_rule.digest.name
+  arn  = aws_lambda_function.app.arn
+}
+
+resource "aws_lambda_permission" "digest_schedule" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.app.function_name
+  principal     = "events.amazonaws.com"
+
+  source_arn = aws_cloudwatch_event_rule.digest.arn
+}